@@ -2,70 +2,12 @@
 
 package main
 
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-)
-
-// album represents data about a record album.
-type album struct {
-	ID     string  `json:"id"`
-	Title  string  `json:"title"`
-	Artist string  `json:"artist"`
-	Price  float64 `json:"price"`
-}
-
-// albums slice to seed record album data.
-var albums = []album{
-	{ID: "1", Title: "Blue Train", Artist: "John Coltrane", Price: 56.99},
-	{ID: "2", Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99},
-	{ID: "3", Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: 39.99},
-}
-
-// getAlbums responds with the list of all albums as JSON.
-func getAlbums(c *gin.Context) {
-	// TODO: Implement get Albums
-	c.IndentedJSON(http.StatusOK, albums)
-
-}
-
-// postAlbums adds an album from JSON received in the request body.
-func postAlbums(c *gin.Context) {
-	// TODO: Implement post Albums
-	var newAlbum album
-	err := c.BindJSON(&newAlbum)
-	if err != nil {
-		return
-	}
-
-	albums = append(albums, newAlbum)
-
-	c.IndentedJSON(http.StatusCreated, newAlbum)
-}
-
-// getAlbumByID locates the album whose ID value matches the id
-// parameter sent by the client, then returns that album as a response.
-func getAlbumByID(c *gin.Context) {
-	// TODO: Implement get Albums by id
-	id := c.Param("id")
-
-	for _, album := range albums {
-		if album.ID == id {
-			c.IndentedJSON(http.StatusOK, album)
-			return
-		}
-	}
-
-	c.IndentedJSON(http.StatusNotFound, gin.H{"message": "album not found"})
-}
+import "albumserver"
 
+// main runs the shared album server, listening on 0.0.0.0:8080 unless
+// configured otherwise (see go run . -h).
 func main() {
-	// TODO: Implement main server
-	router := gin.Default()
-	router.GET("/albums", getAlbums)
-	router.GET("/albums/:id", getAlbumByID)
-	router.POST("/albums", postAlbums)
-	router.Run("0.0.0.0:8080")
-
+	cfg := albumserver.DefaultConfig()
+	cfg.Addr = "0.0.0.0:8080"
+	albumserver.Main(cfg)
 }
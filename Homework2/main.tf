@@ -56,6 +56,14 @@ resource "aws_security_group" "ssh" {
     cidr_blocks = [var.ssh_cidr]  # 8080 
   }
 
+  ingress {
+    description = "gRPC 9090"
+    from_port   = 9090
+    to_port     = 9090
+    protocol    = "tcp"
+    cidr_blocks = [var.ssh_cidr]
+  }
+
   egress {
     from_port   = 0
     to_port     = 0
@@ -10,8 +10,8 @@ class AlbumUser(FastHttpUser):
 
     @task(1)  # POST  tasks ratios 1 (3:1)
     def post_album(self):
+        # No "id": the server generates one (a fixed id would get 409 Conflict)
         self.client.post("/albums", json={
-            "id": "4",
             "title": "Test Album",
             "artist": "Test Artist",
             "price": 29.99
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"mapreduce"
+	"storage"
+)
+
+func main() {
+	mappers := flag.Int("mappers", 3, "number of map tasks (M); the input is split into this many chunks")
+	reducers := flag.Int("reducers", 1, "number of reduce tasks (R); each reduces one hash partition of the keys")
+	concat := flag.Bool("concat", true, "join the reducer outputs into the output; false leaves them as <output>-p<n>.json")
+	intermediate := flag.String("intermediate", string(mapreduce.FormatBinary), "`format` of the map outputs: binary or json")
+	compress := flag.String("compress", string(mapreduce.CompressNone), "compression of binary map outputs: none, gzip or zstd")
+	mapMemory := flag.Int64("map-memory", mapreduce.DefaultMapMemory, "`bytes` of records a map task holds before spilling sorted runs to local disk")
+	parallel := flag.Int("parallel", runtime.NumCPU(), "number of tasks to run at once")
+	retries := flag.Int("retries", 2, "times to retry a failed task")
+	retryDelay := flag.Duration("retry-delay", time.Second, "wait before the first retry; doubles with each retry")
+	workers := flag.String("workers", "inprocess", "where tasks run: inprocess, or subprocess to run the splitter, mapper and reducer commands")
+	binDir := flag.String("bin-dir", "", "`directory` with the splitter, mapper and reducer commands (default: next to the coordinator, then $PATH)")
+	workPrefix := flag.String("work", "", "`prefix` for chunks and intermediate results (default: mapreduce-<time> next to the output)")
+	summaryURL := flag.String("summary", "", "where to write the job summary (default <work>/summary.json)")
+	var report mapreduce.Report
+	report.RegisterFlags(flag.CommandLine)
+	var jobFlags mapreduce.JobFlags
+	jobFlags.RegisterFlags(flag.CommandLine)
+	jobFlags.RegisterTokenizerFlags(flag.CommandLine)
+	storeCfg := storage.DefaultConfig()
+	storeCfg.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Println("Usage: coordinator [flags] <input-url> <output-url>")
+		fmt.Println("Example: coordinator -mappers 8 -reducers 2 s3://bucket/input.txt s3://bucket/final.json")
+		flag.PrintDefaults()
+		fmt.Print("\nJobs:\n" + mapreduce.JobUsage())
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 || *mappers < 1 || *reducers < 1 || *parallel < 1 || *retries < 0 || *mapMemory < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Build the job here even for subprocess workers, to report bad
+	// parameters before any work is done.
+	mrJob, err := jobFlags.Job()
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := mapreduce.Encoding{Format: mapreduce.Format(*intermediate), Compression: mapreduce.Compression(*compress)}
+	if err := enc.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := report.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if report.Enabled() && *reducers > 1 && !*concat {
+		log.Fatal("-top, -csv and -stats report on all the keys, so they need -concat")
+	}
+
+	j := &job{
+		Job:          mrJob.Name,
+		Params:       jobFlags.Params,
+		Input:        flag.Arg(0),
+		Output:       flag.Arg(1),
+		Work:         strings.TrimSuffix(*workPrefix, "/"),
+		Workers:      *workers,
+		Mappers:      *mappers,
+		Reducers:     *reducers,
+		Concat:       *concat,
+		Intermediate: enc,
+		Report:       report,
+		parallel:     *parallel,
+		retries:      *retries,
+		retryDelay:   *retryDelay,
+		store:        storage.New(storeCfg),
+	}
+	if j.Work == "" {
+		dir := "."
+		if i := strings.LastIndex(j.Output, "/"); i >= 0 {
+			dir = j.Output[:i]
+		}
+		j.Work = dir + "/mapreduce-" + time.Now().UTC().Format("20060102T150405Z")
+	}
+	if *summaryURL == "" {
+		*summaryURL = j.Work + "/summary.json"
+	}
+
+	switch *workers {
+	case "inprocess":
+		j.worker = &inProcessWorker{job: mrJob, cfg: storeCfg, store: j.store, mapMemory: *mapMemory, intermediate: enc}
+	case "subprocess":
+		for _, url := range []string{j.Input, j.Output, j.Work} {
+			if strings.HasPrefix(url, "mem://") {
+				log.Fatalf("%s: mem:// storage is not shared with subprocess workers", url)
+			}
+		}
+		w, err := newSubprocessWorker(*binDir, storeCfg, jobFlags.Args(), *mapMemory, enc)
+		if err != nil {
+			log.Fatalf("Error finding worker commands: %v", err)
+		}
+		j.worker = w
+	default:
+		log.Fatalf("Unknown -workers %q: want inprocess or subprocess", *workers)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Job %s: %s -> %s with %d mappers and %d reducers (%s workers)", j.Job, j.Input, j.Output, j.Mappers, j.Reducers, j.Workers)
+	log.Printf("Work prefix: %s", j.Work)
+	runErr := j.run(ctx)
+
+	summary, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		log.Fatalf("Error marshaling summary: %v", err)
+	}
+	// Write the summary even if the job was interrupted.
+	if err := storage.PutBytes(context.WithoutCancel(ctx), j.store, *summaryURL, summary); err != nil {
+		log.Printf("Error uploading summary: %v", err)
+	} else {
+		log.Printf("Summary: %s", *summaryURL)
+	}
+
+	if runErr != nil {
+		log.Fatalf("Job failed: %v", runErr)
+	}
+	if j.Reducers > 1 && !j.Concat {
+		log.Printf("✓ Success! Final results saved to %s", mapreduce.PartitionURL(j.Output, 0)+", ...")
+		return
+	}
+	log.Printf("✓ Success! Final result saved to %s", j.Output)
+}
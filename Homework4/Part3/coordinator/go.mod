@@ -0,0 +1,22 @@
+module coordinator
+
+go 1.25.5
+
+replace (
+	mapreduce => ../mapreduce
+	storage => ../storage
+)
+
+require (
+	mapreduce v0.0.0
+	storage v0.0.0
+)
+
+require (
+	github.com/aws/aws-sdk-go v1.49.0 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+	github.com/klauspost/compress v1.20.1 // indirect
+	github.com/kljensen/snowball v0.10.0 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	golang.org/x/text v0.34.0 // indirect
+)
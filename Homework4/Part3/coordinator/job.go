@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mapreduce"
+	"storage"
+)
+
+// job is one run of a registered mapreduce job, such as wordcount or
+// index, named by Job with its Params. Its exported fields are the job
+// summary.
+type job struct {
+	Job      string           `json:"job"`
+	Params   mapreduce.Params `json:"params,omitempty"`
+	Input    string           `json:"input"`
+	Output   string           `json:"output"`
+	Work     string           `json:"work"`
+	Workers  string           `json:"workers"`
+	Mappers  int              `json:"mappers"`
+	Reducers int              `json:"reducers"`
+	// Concat joins the reducer outputs into Output. Without it, reducer
+	// p writes mapreduce.PartitionURL(Output, p).
+	Concat bool `json:"concat"`
+	// Intermediate is the encoding of the map outputs.
+	Intermediate mapreduce.Encoding `json:"intermediate"`
+	// Report, if enabled, is written to Output instead of the records.
+	Report mapreduce.Report `json:"report,omitzero"`
+
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Started    time.Time `json:"started"`
+	Seconds    float64   `json:"seconds"`
+	TotalBytes int64     `json:"total_bytes"`
+	TotalLines int       `json:"total_lines"`
+	Phases     []*phase  `json:"phases"`
+
+	parallel   int
+	retries    int
+	retryDelay time.Duration
+	store      storage.Storage
+	worker     worker
+}
+
+type phase struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Tasks   []*task `json:"tasks"`
+}
+
+type taskState string
+
+const (
+	pending   taskState = "pending"
+	running   taskState = "running"
+	succeeded taskState = "succeeded"
+	failed    taskState = "failed"
+)
+
+// task is one unit of work in a phase, retried until it succeeds or runs
+// out of attempts.
+type task struct {
+	ID       int       `json:"id"`
+	State    taskState `json:"state"`
+	Attempts int       `json:"attempts"`
+	Errors   []string  `json:"errors,omitempty"`
+	Seconds  float64   `json:"seconds"`
+
+	run func(ctx context.Context) error
+}
+
+// run splits the input, maps every chunk and reduces the results into the
+// output, recording the outcome in j.
+func (j *job) run(ctx context.Context) (err error) {
+	j.Started = time.Now()
+	defer func() {
+		j.Seconds = time.Since(j.Started).Seconds()
+		j.Status = string(succeeded)
+		if err != nil {
+			j.Status, j.Error = string(failed), err.Error()
+		}
+	}()
+
+	chunksPrefix := j.Work + "/chunks"
+	manifestURL := chunksPrefix + "/manifest.json"
+	err = j.runPhase(ctx, "split", []*task{{run: func(ctx context.Context) error {
+		return j.worker.split(ctx, j.Input, chunksPrefix, j.Mappers)
+	}}})
+	if err != nil {
+		return err
+	}
+	m, err := mapreduce.ReadManifest(ctx, j.store, manifestURL)
+	if err != nil {
+		return err
+	}
+	j.TotalBytes, j.TotalLines = m.TotalBytes, m.TotalLines
+	if len(m.Chunks) == 0 {
+		return fmt.Errorf("%s is empty", j.Input)
+	}
+
+	// A small input can give fewer chunks than mappers. Each mapper
+	// partitions its records by key for the reducers.
+	results := mapreduce.ResultURLs(m, j.Work+"/map", j.Intermediate.Format.Ext())
+	mapTasks := make([]*task, len(m.Chunks))
+	for i, c := range m.Chunks {
+		mapTasks[i] = &task{run: func(ctx context.Context) error {
+			return j.worker.mapChunk(ctx, manifestURL, c, results[i], j.Reducers)
+		}}
+	}
+	if err := j.runPhase(ctx, "map", mapTasks); err != nil {
+		return err
+	}
+
+	// Reducer p reduces partition p of every map result. The partitions
+	// share no keys, so the concat phase only has to join them.
+	if j.Reducers == 1 {
+		return j.runPhase(ctx, "reduce", []*task{{run: func(ctx context.Context) error {
+			return j.worker.reduce(ctx, results, j.Output, mapreduce.ReduceOptions{Report: j.Report})
+		}}})
+	}
+	// A report needs every key, so the reducers write sorted binary
+	// records for a report phase to merge.
+	var partOpts mapreduce.ReduceOptions
+	if j.Report.Enabled() {
+		partOpts.Encoding = mapreduce.Encoding{Format: mapreduce.FormatBinary, Compression: j.Intermediate.Compression}
+	}
+	parts := make([]string, j.Reducers)
+	reduceTasks := make([]*task, j.Reducers)
+	for p := range j.Reducers {
+		inputs := make([]string, len(results))
+		for i, url := range results {
+			inputs[i] = mapreduce.PartitionURL(url, p)
+		}
+		parts[p] = mapreduce.PartitionURL(j.Work+"/reduce/final"+partOpts.Encoding.Format.Ext(), p)
+		if !j.Concat {
+			parts[p] = mapreduce.PartitionURL(j.Output, p)
+		}
+		reduceTasks[p] = &task{run: func(ctx context.Context) error {
+			return j.worker.reduce(ctx, inputs, parts[p], partOpts)
+		}}
+	}
+	if err := j.runPhase(ctx, "reduce", reduceTasks); err != nil || !j.Concat {
+		return err
+	}
+	if j.Report.Enabled() {
+		// Each key has one count by now, which the job's Reducer,
+		// adding up counts, leaves as it is.
+		return j.runPhase(ctx, "report", []*task{{run: func(ctx context.Context) error {
+			return j.worker.reduce(ctx, parts, j.Output, mapreduce.ReduceOptions{Report: j.Report})
+		}}})
+	}
+	return j.runPhase(ctx, "concat", []*task{{run: func(ctx context.Context) error {
+		return j.worker.concat(ctx, parts, j.Output)
+	}}})
+}
+
+// runPhase runs tasks on a pool of j.parallel workers. The first task to
+// fail for good cancels the rest, and its error is returned.
+func (j *job) runPhase(ctx context.Context, name string, tasks []*task) error {
+	p := &phase{Name: name, Tasks: tasks}
+	j.Phases = append(j.Phases, p)
+	for i, t := range tasks {
+		t.ID, t.State = i+1, pending
+	}
+	log.Printf("Phase %s: %d tasks", name, len(tasks))
+
+	start := time.Now()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		mu   sync.Mutex
+		done int
+		wg   sync.WaitGroup
+	)
+	queue := make(chan *task)
+	for range min(j.parallel, len(tasks)) {
+		wg.Go(func() {
+			for t := range queue {
+				err := j.runTask(ctx, name, t)
+				mu.Lock()
+				done++
+				log.Printf("Phase %s: task %d %s (%d/%d done)", name, t.ID, t.State, done, len(tasks))
+				mu.Unlock()
+				if err != nil {
+					cancel(fmt.Errorf("%s task %d: %w", name, t.ID, err))
+				}
+			}
+		})
+	}
+feed:
+	for _, t := range tasks {
+		select {
+		case queue <- t:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	p.Seconds = time.Since(start).Seconds()
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+	log.Printf("Phase %s: done in %.1fs", name, p.Seconds)
+	return nil
+}
+
+// runTask runs t, retrying with exponential backoff. Only the goroutine
+// running t touches it until runPhase returns.
+func (j *job) runTask(ctx context.Context, phase string, t *task) error {
+	start := time.Now()
+	defer func() { t.Seconds = time.Since(start).Seconds() }()
+
+	delay := j.retryDelay
+	for {
+		t.State = running
+		t.Attempts++
+		err := t.run(ctx)
+		if err == nil {
+			t.State = succeeded
+			return nil
+		}
+		t.Errors = append(t.Errors, err.Error())
+		t.State = failed
+		if t.Attempts > j.retries || ctx.Err() != nil {
+			return err
+		}
+
+		log.Printf("Phase %s: task %d attempt %d failed, retrying in %s: %v", phase, t.ID, t.Attempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"mapreduce"
+	"storage"
+)
+
+// worker runs the tasks of a job.
+type worker interface {
+	split(ctx context.Context, input, outputPrefix string, chunks int) error
+	mapChunk(ctx context.Context, manifestURL string, c mapreduce.Chunk, output string, partitions int) error
+	reduce(ctx context.Context, inputs []string, output string, opts mapreduce.ReduceOptions) error
+	concat(ctx context.Context, inputs []string, output string) error
+}
+
+// inProcessWorker runs tasks as function calls in the coordinator.
+type inProcessWorker struct {
+	job       *mapreduce.Job
+	cfg       storage.Config
+	store     storage.Storage
+	mapMemory int64
+	// intermediate is the encoding of the map outputs.
+	intermediate mapreduce.Encoding
+}
+
+func (w *inProcessWorker) split(ctx context.Context, input, outputPrefix string, chunks int) error {
+	_, err := mapreduce.Split(ctx, w.cfg, input, outputPrefix, mapreduce.SplitOptions{Chunks: chunks})
+	return err
+}
+
+func (w *inProcessWorker) mapChunk(ctx context.Context, _ string, c mapreduce.Chunk, output string, partitions int) error {
+	return mapreduce.Map(ctx, w.store, w.job, c.URL, output, mapreduce.MapOptions{
+		Size:        c.Size,
+		Offset:      c.Offset,
+		Partitions:  partitions,
+		MemoryLimit: w.mapMemory,
+		Encoding:    w.intermediate,
+	})
+}
+
+func (w *inProcessWorker) reduce(ctx context.Context, inputs []string, output string, opts mapreduce.ReduceOptions) error {
+	_, err := mapreduce.Reduce(ctx, w.store, w.job, inputs, output, opts)
+	return err
+}
+
+func (w *inProcessWorker) concat(ctx context.Context, inputs []string, output string) error {
+	return mapreduce.Concat(ctx, w.store, inputs, output)
+}
+
+// subprocessWorker runs each task as a splitter, mapper or reducer process.
+type subprocessWorker struct {
+	bins map[string]string
+	// storeArgs passes the coordinator's storage settings on.
+	storeArgs []string
+	// jobArgs selects the job in the mapper and reducer.
+	jobArgs   []string
+	mapMemory int64
+	// intermediateArgs sets the encoding of the map outputs.
+	intermediateArgs []string
+}
+
+// newSubprocessWorker finds the worker commands in binDir or, if it is
+// empty, next to the coordinator executable and then in $PATH.
+func newSubprocessWorker(binDir string, cfg storage.Config, jobArgs []string, mapMemory int64, intermediate mapreduce.Encoding) (*subprocessWorker, error) {
+	w := &subprocessWorker{
+		bins:             make(map[string]string),
+		storeArgs:        []string{"-s3-region", cfg.Region, "-s3-endpoint", cfg.Endpoint},
+		jobArgs:          jobArgs,
+		mapMemory:        mapMemory,
+		intermediateArgs: intermediate.Args(),
+	}
+	var dirs []string
+	if binDir != "" {
+		dirs = append(dirs, binDir)
+	} else if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	for _, name := range []string{"splitter", "mapper", "reducer"} {
+		var errs []error
+		for _, dir := range dirs {
+			path, err := exec.LookPath(filepath.Join(dir, name))
+			if err == nil {
+				w.bins[name] = path
+				break
+			}
+			errs = append(errs, err)
+		}
+		if _, ok := w.bins[name]; !ok && binDir == "" {
+			path, err := exec.LookPath(name)
+			if err == nil {
+				w.bins[name] = path
+			}
+			errs = append(errs, err)
+		}
+		if _, ok := w.bins[name]; !ok {
+			return nil, errors.Join(errs...)
+		}
+	}
+	return w, nil
+}
+
+func (w *subprocessWorker) split(ctx context.Context, input, outputPrefix string, chunks int) error {
+	return w.exec(ctx, "splitter", "-chunks", strconv.Itoa(chunks), input, outputPrefix)
+}
+
+func (w *subprocessWorker) mapChunk(ctx context.Context, manifestURL string, c mapreduce.Chunk, output string, partitions int) error {
+	return w.exec(ctx, "mapper", slices.Concat(w.jobArgs, w.intermediateArgs, []string{
+		"-manifest", manifestURL,
+		"-chunk", strconv.Itoa(c.Index),
+		"-partitions", strconv.Itoa(partitions),
+		"-memory-limit", strconv.FormatInt(w.mapMemory, 10),
+		output,
+	})...)
+}
+
+func (w *subprocessWorker) reduce(ctx context.Context, inputs []string, output string, opts mapreduce.ReduceOptions) error {
+	var optArgs []string
+	if opts.Encoding != (mapreduce.Encoding{}) {
+		optArgs = opts.Encoding.Args()
+	}
+	optArgs = append(optArgs, opts.Report.Args()...)
+	return w.exec(ctx, "reducer", slices.Concat(w.jobArgs, optArgs, inputs, []string{output})...)
+}
+
+func (w *subprocessWorker) concat(ctx context.Context, inputs []string, output string) error {
+	return w.exec(ctx, "reducer", append([]string{"-concat"}, append(inputs, output)...)...)
+}
+
+// exec runs the named command and logs its output line by line.
+func (w *subprocessWorker) exec(ctx context.Context, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, w.bins[name], slices.Concat(w.storeArgs, args)...)
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		prefix := fmt.Sprintf("[%s %d] ", name, cmd.Process.Pid)
+		lines := bufio.NewScanner(pr)
+		for lines.Scan() {
+			log.Print(prefix + lines.Text())
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Wait()
+	pw.Close()
+	<-logged
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,397 @@
+package mapreduce
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The binary record format is
+//
+//	"MRREC" version compression
+//
+// followed by a stream, compressed as the compression byte says, of
+//
+//	1 uvarint(len(key)) key uvarint(len(values)) {uvarint(len(value)) value}
+//
+// for each record in key order, then
+//
+//	0 count checksum
+//
+// where count is the number of records as a big-endian uint64 and checksum
+// the CRC-32C of everything in the stream before it, as a big-endian
+// uint32.
+const (
+	binaryMagic   = "MRREC"
+	binaryVersion = 1
+)
+
+// Format is an encoding of records.
+type Format string
+
+const (
+	FormatJSON   Format = "json"
+	FormatBinary Format = "binary"
+)
+
+// Ext is the file extension for records in format f.
+func (f Format) Ext() string {
+	if f == FormatBinary {
+		return ".mrr"
+	}
+	return ".json"
+}
+
+// Compression compresses binary records.
+type Compression string
+
+const (
+	CompressNone Compression = "none"
+	CompressGzip Compression = "gzip"
+	CompressZstd Compression = "zstd"
+)
+
+var compressionIDs = map[Compression]byte{"": 0, CompressNone: 0, CompressGzip: 1, CompressZstd: 2}
+
+// compressionByID is the inverse of compressionIDs.
+func compressionByID(id byte) (Compression, bool) {
+	for c, i := range compressionIDs {
+		if i == id && c != "" {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// Encoding says how Map and Reduce write records.
+type Encoding struct {
+	Format Format `json:"format"`
+	// Compression applies to FormatBinary only.
+	Compression Compression `json:"compression,omitempty"`
+}
+
+// RegisterFlags adds -format and -compress flags that set e.
+func (e *Encoding) RegisterFlags(fs *flag.FlagSet) {
+	if e.Format == "" {
+		e.Format = FormatJSON
+	}
+	if e.Compression == "" {
+		e.Compression = CompressNone
+	}
+	fs.StringVar((*string)(&e.Format), "format", string(e.Format), "record `format`: json or binary")
+	fs.StringVar((*string)(&e.Compression), "compress", string(e.Compression), "`compression` of binary records: none, gzip or zstd")
+}
+
+// Args returns e as flags for the mapper and reducer commands.
+func (e Encoding) Args() []string {
+	return []string{"-format", string(e.Format), "-compress", string(e.Compression)}
+}
+
+// Validate reports an unknown format or compression.
+func (e Encoding) Validate() error {
+	switch e.Format {
+	case "", FormatJSON, FormatBinary:
+	default:
+		return fmt.Errorf("unknown format %q: want json or binary", e.Format)
+	}
+	if _, ok := compressionIDs[e.Compression]; !ok {
+		return fmt.Errorf("unknown compression %q: want none, gzip or zstd", e.Compression)
+	}
+	if e.Compression != "" && e.Compression != CompressNone && e.Format != FormatBinary {
+		return errors.New("only the binary format can be compressed")
+	}
+	return nil
+}
+
+// newRecordWriter returns a writer of sorted records in encoding e,
+// defaulting to JSON.
+func newRecordWriter(w io.Writer, e Encoding) (recordWriter, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	if e.Format == FormatBinary {
+		return newBinaryRecordWriter(w, e.Compression)
+	}
+	return newJSONRecordWriter(w), nil
+}
+
+// openRecordReader returns a reader for the records in r, detecting
+// their format.
+func openRecordReader(r io.Reader, name string) (recordReader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(binaryMagic))
+	if string(magic) == binaryMagic {
+		return newBinaryRecordReader(br, name)
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return newJSONRecordReader(br, name), nil
+}
+
+type binaryRecordWriter struct {
+	w     *bufio.Writer
+	c     io.WriteCloser // compressor writing to w, if any
+	out   *stickyWriter  // c or w, and crc
+	crc   hash.Hash32
+	n     uint64
+	last  string
+	varnt [binary.MaxVarintLen64]byte
+}
+
+// stickyWriter remembers the first write error, so a record can be
+// written without checking every piece of it.
+type stickyWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (s *stickyWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.w.Write(p)
+	s.err = err
+	return n, err
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func newBinaryRecordWriter(w io.Writer, compression Compression) (*binaryRecordWriter, error) {
+	bw := &binaryRecordWriter{w: bufio.NewWriter(w), crc: crc32.New(castagnoli)}
+	bw.w.WriteString(binaryMagic)
+	bw.w.WriteByte(binaryVersion)
+	bw.w.WriteByte(compressionIDs[compression])
+
+	var stream io.Writer = bw.w
+	switch compression {
+	case CompressGzip:
+		bw.c = gzip.NewWriter(bw.w)
+	case CompressZstd:
+		zw, err := zstd.NewWriter(bw.w)
+		if err != nil {
+			return nil, err
+		}
+		bw.c = zw
+	}
+	if bw.c != nil {
+		stream = bw.c
+	}
+	bw.out = &stickyWriter{w: io.MultiWriter(stream, bw.crc)}
+	return bw, nil
+}
+
+func (bw *binaryRecordWriter) write(key string, values []string) error {
+	if bw.n > 0 && key <= bw.last {
+		return fmt.Errorf("key %q written after %q; records must be sorted", key, bw.last)
+	}
+	bw.out.Write([]byte{1})
+	bw.writeString(key)
+	bw.out.Write(bw.varnt[:binary.PutUvarint(bw.varnt[:], uint64(len(values)))])
+	for _, v := range values {
+		bw.writeString(v)
+	}
+	bw.n++
+	bw.last = key
+	return bw.out.err
+}
+
+func (bw *binaryRecordWriter) writeString(s string) {
+	bw.out.Write(bw.varnt[:binary.PutUvarint(bw.varnt[:], uint64(len(s)))])
+	io.WriteString(bw.out, s)
+}
+
+func (bw *binaryRecordWriter) close() error {
+	var footer [1 + 8 + 4]byte
+	if _, err := bw.out.Write(footer[:1]); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(footer[1:], bw.n)
+	binary.BigEndian.PutUint32(footer[9:], bw.crc.Sum32())
+	out := io.Writer(bw.w)
+	if bw.c != nil {
+		out = bw.c
+	}
+	if _, err := out.Write(footer[1:]); err != nil {
+		return err
+	}
+	if bw.c != nil {
+		if err := bw.c.Close(); err != nil {
+			return err
+		}
+	}
+	return bw.w.Flush()
+}
+
+type binaryRecordReader struct {
+	r           hashingReader
+	closeFn     func() // closes the decompressor
+	compression Compression
+	name        string
+	n           uint64
+	last        string
+	done        bool
+}
+
+// hashingReader checksums the bytes read through it. Unlike a TeeReader
+// under a bufio.Reader, it leaves out bytes buffered but not yet read.
+type hashingReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (h hashingReader) ReadByte() (byte, error) {
+	b, err := h.r.ReadByte()
+	if err == nil {
+		h.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (h hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.crc.Write(p[:n])
+	return n, err
+}
+
+func newBinaryRecordReader(br *bufio.Reader, name string) (*binaryRecordReader, error) {
+	var header [len(binaryMagic) + 2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if header[len(binaryMagic)] != binaryVersion {
+		return nil, fmt.Errorf("%s: unsupported record format version %d", name, header[len(binaryMagic)])
+	}
+
+	compression, ok := compressionByID(header[len(binaryMagic)+1])
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown compression %d", name, header[len(binaryMagic)+1])
+	}
+	stream := br
+	closeFn := func() {}
+	switch compression {
+	case CompressGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		stream, closeFn = bufio.NewReader(zr), func() { zr.Close() }
+	case CompressZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		stream, closeFn = bufio.NewReader(zr), zr.Close
+	}
+	return &binaryRecordReader{
+		r:           hashingReader{r: stream, crc: crc32.New(castagnoli)},
+		closeFn:     closeFn,
+		compression: compression,
+		name:        name,
+	}, nil
+}
+
+func (r *binaryRecordReader) next() (string, []string, error) {
+	if r.done {
+		return "", nil, io.EOF
+	}
+	key, values, err := r.read()
+	if err == io.EOF {
+		r.done = true
+		r.closeFn()
+		return "", nil, io.EOF
+	} else if err != nil {
+		r.closeFn()
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", nil, fmt.Errorf("%s: %w", r.name, err)
+	}
+	if r.n > 0 && key <= r.last {
+		return "", nil, fmt.Errorf("%s: key %q comes after %q; records must be sorted", r.name, key, r.last)
+	}
+	r.n++
+	r.last = key
+	return key, values, nil
+}
+
+// read reads one record, or the footer and then returns io.EOF.
+func (r *binaryRecordReader) read() (string, []string, error) {
+	flag, err := r.r.ReadByte()
+	if err != nil {
+		return "", nil, errUnexpectedEOF(err)
+	}
+	if flag == 0 {
+		return "", nil, r.readFooter()
+	} else if flag != 1 {
+		return "", nil, fmt.Errorf("corrupt record marker %d", flag)
+	}
+	key, err := r.readString()
+	if err != nil {
+		return "", nil, err
+	}
+	count, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return "", nil, errUnexpectedEOF(err)
+	}
+	values := make([]string, 0, min(count, 1024))
+	for range count {
+		v, err := r.readString()
+		if err != nil {
+			return "", nil, err
+		}
+		values = append(values, v)
+	}
+	return key, values, nil
+}
+
+func (r *binaryRecordReader) readString() (string, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return "", errUnexpectedEOF(err)
+	}
+	// Grow the buffer as data arrives rather than trusting a corrupt
+	// length.
+	var b []byte
+	if n <= 1<<16 {
+		b = make([]byte, n)
+		_, err = io.ReadFull(r.r, b)
+	} else {
+		b, err = io.ReadAll(io.LimitReader(r.r, int64(n)))
+		if err == nil && uint64(len(b)) != n {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return string(b), errUnexpectedEOF(err)
+}
+
+func (r *binaryRecordReader) readFooter() error {
+	sum := r.r.crc.Sum32()
+	// The footer itself is not part of the checksum.
+	var footer [8 + 4]byte
+	if _, err := io.ReadFull(r.r.r, footer[:]); err != nil {
+		return errUnexpectedEOF(err)
+	}
+	if count := binary.BigEndian.Uint64(footer[:8]); count != r.n {
+		return fmt.Errorf("footer says %d records but there are %d", count, r.n)
+	}
+	if binary.BigEndian.Uint32(footer[8:]) != sum {
+		return errors.New("checksum mismatch")
+	}
+	return io.EOF
+}
+
+func errUnexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
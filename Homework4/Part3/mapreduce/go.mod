@@ -0,0 +1,18 @@
+module mapreduce
+
+go 1.25.5
+
+replace storage => ../storage
+
+require (
+	github.com/klauspost/compress v1.20.1
+	github.com/kljensen/snowball v0.10.0
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/text v0.34.0
+	storage v0.0.0
+)
+
+require (
+	github.com/aws/aws-sdk-go v1.49.0 // indirect
+	github.com/jmespath/go-jmespath v0.4.0 // indirect
+)
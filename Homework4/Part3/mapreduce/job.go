@@ -0,0 +1,172 @@
+package mapreduce
+
+import (
+	"flag"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Emit passes one key-value record on.
+type Emit func(key, value string)
+
+// Mapper turns input records into intermediate records. A record is one
+// line of the input: the key is the byte offset of the line in the whole
+// input and the value the line without its line ending.
+type Mapper interface {
+	Map(key, value string, emit Emit)
+}
+
+// Reducer turns all the intermediate values of one key into output
+// records, usually a single one with the same key.
+type Reducer interface {
+	Reduce(key string, values iter.Seq[string], emit Emit)
+}
+
+// Combiner pre-reduces the values of one key on the map side, before the
+// shuffle, so less data reaches the reducers. What it emits must be valid
+// Reducer input; a Reducer whose output it can take as input again can
+// serve as its own Combiner.
+type Combiner interface {
+	Reducer
+}
+
+// MapperFunc adapts a function to a Mapper.
+type MapperFunc func(key, value string, emit Emit)
+
+func (f MapperFunc) Map(key, value string, emit Emit) { f(key, value, emit) }
+
+// ReducerFunc adapts a function to a Reducer or Combiner.
+type ReducerFunc func(key string, values iter.Seq[string], emit Emit)
+
+func (f ReducerFunc) Reduce(key string, values iter.Seq[string], emit Emit) { f(key, values, emit) }
+
+// Job is a configured MapReduce job.
+type Job struct {
+	Name     string
+	Mapper   Mapper
+	Combiner Combiner // optional
+	Reducer  Reducer
+	// Partition picks the reducer, in [0, n), for key. Nil means the
+	// package-level Partition, a hash of the key.
+	Partition func(key string, n int) int
+	// JSONValues says the values the Reducer emits are JSON documents,
+	// such as numbers, and go into the output as they are. Otherwise
+	// each is written as a JSON string.
+	JSONValues bool
+}
+
+func (j *Job) partition(key string, n int) int {
+	if j.Partition != nil {
+		return j.Partition(key, n)
+	}
+	return Partition(key, n)
+}
+
+// Params are the settings of a job, such as the pattern for grep. As a
+// flag.Value it takes one name=value pair per -param flag.
+type Params map[string]string
+
+func (p Params) String() string {
+	var pairs []string
+	for _, name := range slices.Sorted(maps.Keys(p)) {
+		pairs = append(pairs, name+"="+p[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p Params) Set(pair string) error {
+	name, value, ok := strings.Cut(pair, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("%q is not name=value", pair)
+	}
+	p[name] = value
+	return nil
+}
+
+// only rejects parameters other than names, to catch typos.
+func (p Params) only(names ...string) error {
+	for name := range p {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+	return nil
+}
+
+// JobFactory builds a job from its parameters.
+type JobFactory func(params Params) (*Job, error)
+
+type registeredJob struct {
+	usage string
+	new   JobFactory
+}
+
+var jobs = make(map[string]registeredJob)
+
+// Register makes a job available to NewJob under name. usage describes
+// the job and its parameters for -help output. Register panics if name is
+// taken.
+func Register(name, usage string, factory JobFactory) {
+	if _, ok := jobs[name]; ok {
+		panic("mapreduce: job " + name + " registered twice")
+	}
+	jobs[name] = registeredJob{usage: usage, new: factory}
+}
+
+// NewJob builds the job registered as name.
+func NewJob(name string, params Params) (*Job, error) {
+	r, ok := jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown job %q; the jobs are %s", name, strings.Join(slices.Sorted(maps.Keys(jobs)), ", "))
+	}
+	job, err := r.new(params)
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", name, err)
+	}
+	job.Name = name
+	return job, nil
+}
+
+// JobUsage lists the registered jobs and their usage, one per line.
+func JobUsage() string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(jobs)) {
+		fmt.Fprintf(&b, "  %-10s %s\n", name, jobs[name].usage)
+	}
+	return b.String()
+}
+
+// JobFlags selects a job on the command line.
+type JobFlags struct {
+	Name   string
+	Params Params
+}
+
+// RegisterFlags adds -job and -param flags that set f.
+func (f *JobFlags) RegisterFlags(fs *flag.FlagSet) {
+	if f.Name == "" {
+		f.Name = "wordcount"
+	}
+	if f.Params == nil {
+		f.Params = make(Params)
+	}
+	fs.StringVar(&f.Name, "job", f.Name, "`name` of the job to run; see below")
+	fs.Var(f.Params, "param", "job parameter as `name=value`; may be repeated")
+}
+
+// Job builds the selected job.
+func (f *JobFlags) Job() (*Job, error) {
+	return NewJob(f.Name, f.Params)
+}
+
+// Args returns f as flags for the mapper and reducer commands.
+func (f *JobFlags) Args() []string {
+	args := []string{"-job", f.Name}
+	for _, name := range slices.Sorted(maps.Keys(f.Params)) {
+		args = append(args, "-param", name+"="+f.Params[name])
+	}
+	return args
+}
@@ -0,0 +1,218 @@
+package mapreduce
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"iter"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("wordcount", "counts each word (the default); words are split as -param tokenizer, case, stopwords, stem and ngram say", newWordCount)
+	Register("index", "lists the documents each word is in; a line is a document, named by the text before a tab or else by its byte offset; words are split as -param tokenizer, case, stopwords, stem and ngram say", newInvertedIndex)
+	Register("grep", "counts the lines matching -param pattern=<regexp>", newGrep)
+	Register("sort", "sorts the lines, counting duplicates; reducer outputs concatenate in order", newSort)
+	Register("logs", "counts log lines by -param field=<n> (default 1), optionally adding up -param sum=<n>; fields are split on whitespace or -param sep=<s>", newLogAggregation)
+}
+
+func newWordCount(params Params) (*Job, error) {
+	if err := params.only(tokenizerParamNames()...); err != nil {
+		return nil, err
+	}
+	tok, err := newTokenizer(params)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{
+		Mapper: MapperFunc(func(_, line string, emit Emit) {
+			for _, word := range tok.words(line) {
+				emit(word, "1")
+			}
+		}),
+		Combiner:   sum,
+		Reducer:    sum,
+		JSONValues: true,
+	}, nil
+}
+
+// sum adds up integer values.
+var sum = ReducerFunc(func(key string, values iter.Seq[string], emit Emit) {
+	total := 0
+	for v := range values {
+		n, _ := strconv.Atoi(v)
+		total += n
+	}
+	emit(key, strconv.Itoa(total))
+})
+
+func newInvertedIndex(params Params) (*Job, error) {
+	if err := params.only(tokenizerParamNames()...); err != nil {
+		return nil, err
+	}
+	tok, err := newTokenizer(params)
+	if err != nil {
+		return nil, err
+	}
+	return &Job{
+		Mapper: MapperFunc(func(offset, line string, emit Emit) {
+			doc := offset
+			if name, text, ok := strings.Cut(line, "\t"); ok {
+				doc, line = name, text
+			}
+			seen := make(map[string]bool)
+			for _, word := range tok.words(line) {
+				if !seen[word] {
+					seen[word] = true
+					emit(word, doc)
+				}
+			}
+		}),
+		Combiner: ReducerFunc(func(word string, docs iter.Seq[string], emit Emit) {
+			for _, doc := range uniqueDocs(docs) {
+				emit(word, doc)
+			}
+		}),
+		Reducer: ReducerFunc(func(word string, docs iter.Seq[string], emit Emit) {
+			list, _ := json.Marshal(uniqueDocs(docs))
+			emit(word, string(list))
+		}),
+		JSONValues: true,
+	}, nil
+}
+
+// uniqueDocs sorts document names, numerically for byte offsets, and
+// drops duplicates.
+func uniqueDocs(docs iter.Seq[string]) []string {
+	return slices.Compact(slices.SortedFunc(docs, func(a, b string) int {
+		x, errA := strconv.ParseInt(a, 10, 64)
+		y, errB := strconv.ParseInt(b, 10, 64)
+		if errA == nil && errB == nil {
+			return cmp.Compare(x, y)
+		}
+		return strings.Compare(a, b)
+	}))
+}
+
+func newGrep(params Params) (*Job, error) {
+	if err := params.only("pattern"); err != nil {
+		return nil, err
+	}
+	if params["pattern"] == "" {
+		return nil, errors.New("missing -param pattern=<regexp>")
+	}
+	re, err := regexp.Compile(params["pattern"])
+	if err != nil {
+		return nil, err
+	}
+	return &Job{
+		Mapper: MapperFunc(func(_, line string, emit Emit) {
+			if re.MatchString(line) {
+				emit(line, "1")
+			}
+		}),
+		Combiner:   sum,
+		Reducer:    sum,
+		JSONValues: true,
+	}, nil
+}
+
+func newSort(params Params) (*Job, error) {
+	if err := params.only(); err != nil {
+		return nil, err
+	}
+	return &Job{
+		Mapper: MapperFunc(func(_, line string, emit Emit) {
+			emit(line, "1")
+		}),
+		Combiner: sum,
+		Reducer:  sum,
+		// Partition by range of the first byte rather than by hash, so
+		// every key in partition p sorts before those in p+1.
+		Partition: func(key string, n int) int {
+			if key == "" {
+				return 0
+			}
+			return int(key[0]) * n / 256
+		},
+		JSONValues: true,
+	}, nil
+}
+
+// logStats is the value of the logs job at every stage.
+type logStats struct {
+	Count int64    `json:"count"`
+	Sum   *float64 `json:"sum,omitempty"`
+}
+
+func newLogAggregation(params Params) (*Job, error) {
+	if err := params.only("field", "sum", "sep"); err != nil {
+		return nil, err
+	}
+	field, err := fieldParam(params, "field", 1)
+	if err != nil {
+		return nil, err
+	}
+	sumField, err := fieldParam(params, "sum", 0)
+	if err != nil {
+		return nil, err
+	}
+	split := strings.Fields
+	if sep := params["sep"]; sep != "" {
+		split = func(line string) []string { return strings.Split(line, sep) }
+	}
+
+	merge := ReducerFunc(func(key string, values iter.Seq[string], emit Emit) {
+		var total logStats
+		for v := range values {
+			var s logStats
+			if json.Unmarshal([]byte(v), &s) != nil {
+				continue
+			}
+			total.Count += s.Count
+			if s.Sum != nil {
+				if total.Sum == nil {
+					total.Sum = new(float64)
+				}
+				*total.Sum += *s.Sum
+			}
+		}
+		out, _ := json.Marshal(total)
+		emit(key, string(out))
+	})
+	return &Job{
+		Mapper: MapperFunc(func(_, line string, emit Emit) {
+			fields := split(line)
+			if len(fields) < field {
+				return
+			}
+			s := logStats{Count: 1}
+			if sumField > 0 && len(fields) >= sumField {
+				if x, err := strconv.ParseFloat(fields[sumField-1], 64); err == nil {
+					s.Sum = &x
+				}
+			}
+			out, _ := json.Marshal(s)
+			emit(fields[field-1], string(out))
+		}),
+		Combiner:   merge,
+		Reducer:    merge,
+		JSONValues: true,
+	}, nil
+}
+
+// fieldParam reads a 1-based field number, or def if it is not set.
+func fieldParam(params Params, name string, def int) (int, error) {
+	v, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, errors.New("-param " + name + " must be a field number from 1")
+	}
+	return n, nil
+}
@@ -0,0 +1,71 @@
+// Package mapreduce runs MapReduce jobs over text, as in Homework 4:
+// Split cuts the input into chunks, Map runs a job's Mapper over the lines
+// of one chunk and Reduce runs its Reducer over one partition of the map
+// output. The splitter, mapper and reducer commands each run one of them,
+// and the coordinator runs a whole job. Jobs are registered by name; word
+// count is the default.
+package mapreduce
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"storage"
+)
+
+// Manifest describes the chunks written by one Split. The mapper reads it
+// to find its chunk and the reducer to find every mapper result.
+type Manifest struct {
+	Input      string  `json:"input"`
+	TotalBytes int64   `json:"total_bytes"`
+	TotalLines int     `json:"total_lines"`
+	Chunks     []Chunk `json:"chunks"`
+}
+
+// Chunk is one piece of the input: bytes [Offset, Offset+Size) of it.
+type Chunk struct {
+	Index  int    `json:"index"` // 1-based, matching chunk<Index>.txt
+	URL    string `json:"url"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Lines  int    `json:"lines"`
+}
+
+// ReadManifest loads the manifest at url.
+func ReadManifest(ctx context.Context, store storage.Storage, url string) (*Manifest, error) {
+	data, err := storage.GetBytes(ctx, store, url)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return &m, nil
+}
+
+// Chunk returns the chunk with the given 1-based index.
+func (m *Manifest) Chunk(index int) (Chunk, error) {
+	for _, c := range m.Chunks {
+		if c.Index == index {
+			return c, nil
+		}
+	}
+	return Chunk{}, fmt.Errorf("no chunk %d (the manifest has %d chunks)", index, len(m.Chunks))
+}
+
+// ResultURLs returns the URL under prefix of the mapper result for each
+// chunk in m, named result<index><ext>.
+func ResultURLs(m *Manifest, prefix, ext string) []string {
+	urls := make([]string, len(m.Chunks))
+	for i, c := range m.Chunks {
+		urls[i] = ResultURL(prefix, c.Index, ext)
+	}
+	return urls
+}
+
+// ResultURL is the URL under prefix of the mapper result for chunk index.
+func ResultURL(prefix string, index int, ext string) string {
+	return fmt.Sprintf("%s/result%d%s", prefix, index, ext)
+}
@@ -0,0 +1,145 @@
+package mapreduce
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"storage"
+)
+
+// MapOptions controls how Map reads its input and writes its output.
+type MapOptions struct {
+	// Size, if positive, is checked against the length of the input, to
+	// catch a chunk that does not match its manifest.
+	Size int64
+	// Offset is where the input starts in the whole input, for the keys
+	// of the input records.
+	Offset int64
+	// Partitions is the number of reducers to partition the output for.
+	// With more than one, key k goes to PartitionURL(output, p) with
+	// p = job.Partition(k, Partitions), and output itself is not written.
+	Partitions int
+	// MemoryLimit is roughly how many bytes of records Map holds before
+	// it spills them to disk as sorted runs, which it merges at the end.
+	// Zero means DefaultMapMemory.
+	MemoryLimit int64
+	// SpillDir is where the runs go. Empty means the system temporary
+	// directory.
+	SpillDir string
+	// Encoding is the format of the output. The zero value is JSON.
+	Encoding Encoding
+}
+
+// Map runs job's Mapper over the lines of the object at input, then its
+// Combiner if it has one, and writes the intermediate records to output
+// sorted by key, or to one output per partition.
+func Map(ctx context.Context, store storage.Storage, job *Job, input, output string, opts MapOptions) error {
+	obj, err := store.Get(ctx, input)
+	if err != nil {
+		return fmt.Errorf("downloading: %w", err)
+	}
+	defer obj.Close()
+
+	partitions := max(1, opts.Partitions)
+	limit := opts.MemoryLimit
+	if limit <= 0 {
+		limit = DefaultMapMemory
+	}
+	buf := newMapBuffer(partitions, limit, job.Combiner, opts.SpillDir)
+	defer buf.close()
+	emit := func(key, value string) {
+		p := 0
+		if partitions > 1 {
+			p = job.partition(key, partitions)
+		}
+		buf.add(p, key, value)
+	}
+
+	r := bufio.NewReader(obj)
+	offset := opts.Offset
+	for {
+		line, err := r.ReadString('\n')
+		if len(line) > 0 {
+			text := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			job.Mapper.Map(strconv.FormatInt(offset, 10), text, emit)
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("downloading: %w", err)
+		}
+		if buf.err != nil {
+			return fmt.Errorf("spilling: %w", buf.err)
+		}
+	}
+	size := offset - opts.Offset
+	log.Printf("Mapped %d bytes", size)
+	if opts.Size > 0 && size != opts.Size {
+		return fmt.Errorf("%s is %d bytes but the manifest says %d", input, size, opts.Size)
+	}
+
+	for p := range partitions {
+		url := output
+		if partitions > 1 {
+			url = PartitionURL(output, p)
+		}
+		if err := putRecords(ctx, store, url, opts.Encoding, func(w recordWriter) error {
+			return buf.merge(p, w.write)
+		}); err != nil {
+			return err
+		}
+		log.Printf("Partition %d: %d spills", p, len(buf.runs[p]))
+	}
+	return nil
+}
+
+// putRecords streams the records that write writes to the object at url
+// in encoding enc.
+func putRecords(ctx context.Context, store storage.Storage, url string, enc Encoding, write func(w recordWriter) error) error {
+	return upload(ctx, store, url, func(pw io.Writer) error {
+		w, err := newRecordWriter(pw, enc)
+		if err != nil {
+			return err
+		}
+		if err := write(w); err != nil {
+			return err
+		}
+		return w.close()
+	})
+}
+
+// errUploadFailed is what the writer of an upload sees once the upload
+// has failed, to tell that apart from its own errors.
+var errUploadFailed = errors.New("upload failed")
+
+// upload streams what write writes to the object at url. An error from
+// write is returned as it is, and one from the store as an upload error.
+func upload(ctx context.Context, store storage.Storage, url string, write func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	err := store.Put(ctx, url, pr)
+	if err != nil {
+		pr.CloseWithError(errUploadFailed)
+	} else {
+		pr.Close()
+	}
+	if werr := <-written; werr != nil && !errors.Is(werr, errUploadFailed) {
+		return werr
+	}
+	if err != nil {
+		return fmt.Errorf("uploading: %w", err)
+	}
+	return nil
+}
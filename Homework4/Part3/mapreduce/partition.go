@@ -0,0 +1,120 @@
+package mapreduce
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"path"
+	"strings"
+
+	"storage"
+)
+
+// Partition returns the reducer, in [0, n), that word belongs to.
+func Partition(word string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(word))
+	return int(h.Sum32() % uint32(n))
+}
+
+// PartitionURL names partition p of the output at url: result1.json
+// becomes result1-p0.json, result1-p1.json and so on, keeping any
+// extension.
+func PartitionURL(url string, p int) string {
+	ext := path.Ext(url)
+	return fmt.Sprintf("%s-p%d%s", strings.TrimSuffix(url, ext), p, ext)
+}
+
+// Concat joins the reducer outputs at inputs into one at output, in the
+// format of the first. JSON objects must have no keys in common, as
+// reducers of different partitions do not, so they are copied through
+// without being parsed; binary records are merged to keep them sorted.
+func Concat(ctx context.Context, store storage.Storage, inputs []string, output string) error {
+	join := concatObjects
+	if len(inputs) > 0 {
+		obj, err := store.Get(ctx, inputs[0])
+		if err != nil {
+			return fmt.Errorf("downloading: %w", err)
+		}
+		r, err := openRecordReader(obj, inputs[0])
+		obj.Close()
+		if err != nil {
+			return err
+		}
+		if br, ok := r.(*binaryRecordReader); ok {
+			join = func(ctx context.Context, store storage.Storage, inputs []string, w io.Writer) error {
+				return mergeBinary(ctx, store, inputs, br.compression, w)
+			}
+		}
+	}
+
+	err := upload(ctx, store, output, func(w io.Writer) error {
+		return join(ctx, store, inputs, w)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Concatenated %d partitions", len(inputs))
+	return nil
+}
+
+func concatObjects(ctx context.Context, store storage.Storage, inputs []string, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteByte('{')
+	empty := true
+	for _, url := range inputs {
+		obj, err := store.Get(ctx, url)
+		if err != nil {
+			return fmt.Errorf("downloading: %w", err)
+		}
+		// Reduce writes compact JSON, so the members are everything
+		// between the first and the last byte.
+		r := bufio.NewReader(obj)
+		if b, err := r.ReadByte(); err != nil || b != '{' || obj.Size < 2 {
+			obj.Close()
+			return fmt.Errorf("%s: not a JSON object", url)
+		}
+		if obj.Size > 2 {
+			if !empty {
+				bw.WriteByte(',')
+			}
+			empty = false
+			if _, err := io.CopyN(bw, r, obj.Size-2); err != nil {
+				obj.Close()
+				return fmt.Errorf("%s: %w", url, err)
+			}
+		}
+		b, err := r.ReadByte()
+		obj.Close()
+		if err != nil || b != '}' {
+			return fmt.Errorf("%s: not a JSON object", url)
+		}
+	}
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+func mergeBinary(ctx context.Context, store storage.Storage, inputs []string, compression Compression, w io.Writer) error {
+	readers := make([]recordReader, len(inputs))
+	for i, url := range inputs {
+		obj, err := store.Get(ctx, url)
+		if err != nil {
+			return fmt.Errorf("downloading: %w", err)
+		}
+		defer obj.Close()
+		if readers[i], err = openRecordReader(obj, url); err != nil {
+			return err
+		}
+	}
+	bw, err := newBinaryRecordWriter(w, compression)
+	if err != nil {
+		return err
+	}
+	if err := mergeRecords(readers, bw.write); err != nil {
+		return err
+	}
+	return bw.close()
+}
@@ -0,0 +1,189 @@
+package mapreduce
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Intermediate records, between Map and Reduce and in spill files, are
+// sorted by key so that files can be merged as streams. They are encoded
+// in the binary format described in binary.go or as a JSON object from
+// each key to the list of its values.
+
+// recordReader returns the records of a sorted stream in order, then
+// io.EOF.
+type recordReader interface {
+	next() (key string, values []string, err error)
+}
+
+// jsonRecordReader decodes a JSON object of records one member at a time.
+type jsonRecordReader struct {
+	dec     *json.Decoder
+	name    string
+	started bool
+	n       int
+	last    string
+}
+
+func newJSONRecordReader(r io.Reader, name string) *jsonRecordReader {
+	return &jsonRecordReader{dec: json.NewDecoder(bufio.NewReader(r)), name: name}
+}
+
+func (r *jsonRecordReader) next() (string, []string, error) {
+	if !r.started {
+		if tok, err := r.dec.Token(); err != nil || tok != json.Delim('{') {
+			return "", nil, fmt.Errorf("%s: not a JSON object of records", r.name)
+		}
+		r.started = true
+	}
+	tok, err := r.dec.Token()
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", r.name, err)
+	}
+	if tok == json.Delim('}') {
+		return "", nil, io.EOF
+	}
+	key := tok.(string)
+	var values []string
+	if err := r.dec.Decode(&values); err != nil {
+		return "", nil, fmt.Errorf("%s: key %q: %w", r.name, key, err)
+	}
+	if r.n > 0 && key <= r.last {
+		return "", nil, fmt.Errorf("%s: key %q comes after %q; records must be sorted", r.name, key, r.last)
+	}
+	r.n++
+	r.last = key
+	return key, values, nil
+}
+
+// sliceRecordReader reads records held in memory, sorting them first.
+type sliceRecordReader struct {
+	records map[string][]string
+	keys    []string
+}
+
+func newSliceRecordReader(records map[string][]string) *sliceRecordReader {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return &sliceRecordReader{records: records, keys: keys}
+}
+
+func (r *sliceRecordReader) next() (string, []string, error) {
+	if len(r.keys) == 0 {
+		return "", nil, io.EOF
+	}
+	key := r.keys[0]
+	r.keys = r.keys[1:]
+	return key, r.records[key], nil
+}
+
+// recordWriter writes records, which must come in sorted order.
+type recordWriter interface {
+	write(key string, values []string) error
+	close() error
+}
+
+// jsonRecordWriter writes records as one JSON object.
+type jsonRecordWriter struct {
+	w    *bufio.Writer
+	n    int
+	last string
+}
+
+func newJSONRecordWriter(w io.Writer) *jsonRecordWriter {
+	rw := &jsonRecordWriter{w: bufio.NewWriter(w)}
+	rw.w.WriteByte('{')
+	return rw
+}
+
+func (rw *jsonRecordWriter) write(key string, values []string) error {
+	if rw.n > 0 && key <= rw.last {
+		return fmt.Errorf("key %q written after %q; a Combiner must emit the key it is given", key, rw.last)
+	}
+	k, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if rw.n > 0 {
+		rw.w.WriteByte(',')
+	}
+	rw.w.Write(k)
+	rw.w.WriteByte(':')
+	_, err = rw.w.Write(v)
+	rw.n++
+	rw.last = key
+	return err
+}
+
+func (rw *jsonRecordWriter) close() error {
+	rw.w.WriteByte('}')
+	return rw.w.Flush()
+}
+
+// mergeRecords merges sorted streams, calling fn once per key with the
+// values of that key from all of them, in key order.
+func mergeRecords(readers []recordReader, fn func(key string, values []string) error) error {
+	h := &recordHeap{}
+	for _, r := range readers {
+		if err := h.pushNext(r); err != nil {
+			return err
+		}
+	}
+	for h.Len() > 0 {
+		key := (*h)[0].key
+		var values []string
+		for h.Len() > 0 && (*h)[0].key == key {
+			top := heap.Pop(h).(*heapRecord)
+			values = append(values, top.values...)
+			if err := h.pushNext(top.r); err != nil {
+				return err
+			}
+		}
+		if err := fn(key, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type heapRecord struct {
+	key    string
+	values []string
+	r      recordReader
+}
+
+type recordHeap []*heapRecord
+
+func (h recordHeap) Len() int           { return len(h) }
+func (h recordHeap) Less(i, j int) bool { return h[i].key < h[j].key }
+func (h recordHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *recordHeap) Push(x any)        { *h = append(*h, x.(*heapRecord)) }
+func (h *recordHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// pushNext reads the next record of r onto the heap, if there is one.
+func (h *recordHeap) pushNext(r recordReader) error {
+	key, values, err := r.next()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	heap.Push(h, &heapRecord{key: key, values: values, r: r})
+	return nil
+}
@@ -0,0 +1,147 @@
+package mapreduce
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+
+	"storage"
+)
+
+// ReduceOptions controls what Reduce writes.
+type ReduceOptions struct {
+	// Encoding is the format of the records. The zero value is JSON.
+	Encoding Encoding
+	// Report, if enabled, replaces the records with a report on them.
+	Report Report
+}
+
+// Reduce merges the sorted map outputs at inputs as streams, in either
+// format, runs job's Reducer over the values of each key in order and
+// writes what it emits to output, by default as a JSON object, or a
+// report on it. Only one key's values are held in memory at a time,
+// except for a CSV report of every key. It returns the number of records
+// the Reducer emitted.
+func Reduce(ctx context.Context, store storage.Storage, job *Job, inputs []string, output string, opts ReduceOptions) (int, error) {
+	if err := opts.Encoding.Validate(); err != nil {
+		return 0, err
+	}
+	if err := opts.Report.Validate(); err != nil {
+		return 0, err
+	}
+	if opts.Report.Enabled() && opts.Encoding.Format == FormatBinary {
+		return 0, errors.New("a report has its own format; it cannot be binary")
+	}
+
+	readers := make([]recordReader, len(inputs))
+	for i, url := range inputs {
+		obj, err := store.Get(ctx, url)
+		if err != nil {
+			return 0, fmt.Errorf("downloading: %w", err)
+		}
+		defer obj.Close()
+		if readers[i], err = openRecordReader(obj, url); err != nil {
+			return 0, err
+		}
+	}
+	log.Printf("Merging %d inputs", len(inputs))
+
+	var n int
+	err := upload(ctx, store, output, func(pw io.Writer) error {
+		w, err := newOutputWriter(pw, job.JSONValues, opts)
+		if err != nil {
+			return err
+		}
+		err = mergeRecords(readers, func(key string, values []string) error {
+			job.Reducer.Reduce(key, slices.Values(values), w.emit)
+			return w.err
+		})
+		n = w.n
+		if err != nil {
+			return err
+		}
+		return w.close()
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Total keys: %d", n)
+	return n, nil
+}
+
+// outputWriter writes what a Reducer emits. In JSON, the records are the
+// members of one compact JSON object, which Concat relies on; in binary,
+// each is a record with one value. A report is written at the end.
+type outputWriter struct {
+	json       *bufio.Writer
+	jsonValues bool
+	records    recordWriter // binary only
+	report     *countReport // reports only
+	w          io.Writer
+	n          int
+	err        error
+}
+
+func newOutputWriter(w io.Writer, jsonValues bool, opts ReduceOptions) (*outputWriter, error) {
+	if opts.Report.Enabled() {
+		return &outputWriter{report: newCountReport(opts.Report), w: w}, nil
+	}
+	if enc := opts.Encoding; enc.Format == FormatBinary {
+		records, err := newBinaryRecordWriter(w, enc.Compression)
+		return &outputWriter{records: records}, err
+	}
+	o := &outputWriter{json: bufio.NewWriter(w), jsonValues: jsonValues}
+	o.json.WriteByte('{')
+	return o, nil
+}
+
+func (o *outputWriter) emit(key, value string) {
+	if o.err != nil {
+		return
+	}
+	if o.records != nil {
+		o.err = o.records.write(key, []string{value})
+		o.n++
+		return
+	}
+	if o.report != nil {
+		o.err = o.report.add(key, value)
+		o.n++
+		return
+	}
+
+	k, _ := json.Marshal(key)
+	v := []byte(value)
+	if !o.jsonValues {
+		v, _ = json.Marshal(value)
+	} else if !json.Valid(v) {
+		o.err = fmt.Errorf("key %q: reducer emitted %q, which is not JSON", key, value)
+		return
+	}
+	if o.n > 0 {
+		o.json.WriteByte(',')
+	}
+	o.json.Write(k)
+	o.json.WriteByte(':')
+	o.json.Write(v)
+	o.n++
+}
+
+func (o *outputWriter) close() error {
+	if o.err != nil {
+		return o.err
+	}
+	if o.records != nil {
+		return o.records.close()
+	}
+	if o.report != nil {
+		return o.report.write(o.w)
+	}
+	o.json.WriteByte('}')
+	return o.json.Flush()
+}
@@ -0,0 +1,192 @@
+package mapreduce
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// Report replaces the records Reduce writes with a report on their
+// values, for jobs whose values are counts, such as wordcount.
+type Report struct {
+	// Top keeps only the Top keys with the highest counts, found with a
+	// heap of that size. Zero keeps them all.
+	Top int `json:"top,omitempty"`
+	// CSV writes key,count rows, highest count first, rather than a
+	// JSON object in that order.
+	CSV bool `json:"csv,omitempty"`
+	// Stats writes statistics on the counts as JSON: the total count,
+	// the number of keys and how many keys have each count, as well as
+	// the Top keys if Top is set.
+	Stats bool `json:"stats,omitempty"`
+}
+
+// RegisterFlags adds -top, -csv and -stats flags that set r.
+func (r *Report) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&r.Top, "top", r.Top, "write only the `K` keys with the highest counts, highest first")
+	fs.BoolVar(&r.CSV, "csv", r.CSV, "write key,count CSV rows sorted by count, highest first")
+	fs.BoolVar(&r.Stats, "stats", r.Stats, "write statistics on the counts as JSON: total count, number of keys, frequency of each count and, with -top, the top keys")
+}
+
+// Args returns r as flags for the reducer command.
+func (r Report) Args() []string {
+	var args []string
+	if r.Top > 0 {
+		args = append(args, "-top", strconv.Itoa(r.Top))
+	}
+	if r.CSV {
+		args = append(args, "-csv")
+	}
+	if r.Stats {
+		args = append(args, "-stats")
+	}
+	return args
+}
+
+// Enabled reports whether r asks for a report rather than the records.
+func (r Report) Enabled() bool {
+	return r.Top > 0 || r.CSV || r.Stats
+}
+
+// Validate reports options that do not go together.
+func (r Report) Validate() error {
+	if r.Top < 0 {
+		return fmt.Errorf("top %d is negative", r.Top)
+	}
+	if r.CSV && r.Stats {
+		return errors.New("statistics are JSON; choose CSV or statistics")
+	}
+	return nil
+}
+
+type keyCount struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// byCount orders a before b if it has the higher count, or the same
+// count and the lower key.
+func byCount(a, b keyCount) int {
+	if c := cmp.Compare(b.Count, a.Count); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Key, b.Key)
+}
+
+// countReport builds a Report from the records a Reducer emits.
+type countReport struct {
+	report Report
+	total  int64
+	keys   int64
+	freqs  map[int64]int64 // number of keys with each count
+	top    topHeap
+	all    []keyCount // for a CSV report of every key
+}
+
+func newCountReport(report Report) *countReport {
+	return &countReport{report: report, freqs: make(map[int64]int64)}
+}
+
+func (c *countReport) add(key, value string) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("key %q: reducer emitted %q, which is not a count", key, value)
+	}
+	c.total += n
+	c.keys++
+	c.freqs[n]++
+
+	kc := keyCount{key, n}
+	switch {
+	case c.report.Top > 0:
+		// The heap holds the top keys so far, the lowest at the root.
+		if c.top.Len() < c.report.Top {
+			heap.Push(&c.top, kc)
+		} else if byCount(kc, c.top[0]) < 0 {
+			c.top[0] = kc
+			heap.Fix(&c.top, 0)
+		}
+	case !c.report.Stats:
+		c.all = append(c.all, kc)
+	}
+	return nil
+}
+
+func (c *countReport) write(w io.Writer) error {
+	rows := c.all
+	if c.report.Top > 0 {
+		rows = c.top
+	}
+	slices.SortFunc(rows, byCount)
+
+	switch {
+	case c.report.Stats:
+		type frequency struct {
+			Count int64 `json:"count"`
+			Keys  int64 `json:"keys"`
+		}
+		stats := struct {
+			Total int64       `json:"total"`
+			Keys  int64       `json:"keys"`
+			Freqs []frequency `json:"frequency_of_frequency"`
+			Top   []keyCount  `json:"top,omitempty"`
+		}{Total: c.total, Keys: c.keys, Freqs: []frequency{}, Top: rows}
+		for _, n := range slices.Sorted(maps.Keys(c.freqs)) {
+			stats.Freqs = append(stats.Freqs, frequency{n, c.freqs[n]})
+		}
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+
+	case c.report.CSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"key", "count"})
+		for _, row := range rows {
+			cw.Write([]string{row.Key, strconv.FormatInt(row.Count, 10)})
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		// A JSON object like the records, but in count order.
+		bw := bufio.NewWriter(w)
+		bw.WriteByte('{')
+		for i, row := range rows {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			k, _ := json.Marshal(row.Key)
+			bw.Write(k)
+			bw.WriteByte(':')
+			bw.WriteString(strconv.FormatInt(row.Count, 10))
+		}
+		bw.WriteByte('}')
+		return bw.Flush()
+	}
+}
+
+// topHeap is a min-heap of keys by count, the lowest-ranked at the root.
+type topHeap []keyCount
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return byCount(h[i], h[j]) > 0 }
+func (h topHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x any)        { *h = append(*h, x.(keyCount)) }
+func (h *topHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,208 @@
+package mapreduce
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+)
+
+// DefaultMapMemory is the default MapOptions.MemoryLimit.
+const DefaultMapMemory = 64 << 20
+
+// recordOverhead roughly accounts for the map entry and slice header
+// behind each buffered key and value.
+const recordOverhead = 48
+
+// maxMergeRuns is the most spill files a merge opens at once. A partition
+// with more runs is merged in passes, each of which merges its first
+// maxMergeRuns runs into a new one.
+const maxMergeRuns = 64
+
+// mapBuffer holds the records a Mapper emits, per partition. Once they
+// take more than limit bytes, it combines them, and if that does not free
+// half the buffer, spills each partition as a sorted run to a file in dir.
+type mapBuffer struct {
+	parts    []map[string][]string
+	bytes    int64
+	limit    int64
+	combiner Combiner
+	dir      string
+	runs     [][]string // spill files of each partition
+	err      error
+}
+
+func newMapBuffer(partitions int, limit int64, combiner Combiner, dir string) *mapBuffer {
+	b := &mapBuffer{
+		parts:    make([]map[string][]string, partitions),
+		limit:    limit,
+		combiner: combiner,
+		dir:      dir,
+		runs:     make([][]string, partitions),
+	}
+	for p := range b.parts {
+		b.parts[p] = make(map[string][]string)
+	}
+	return b
+}
+
+func (b *mapBuffer) add(p int, key, value string) {
+	if b.err != nil {
+		return
+	}
+	values, ok := b.parts[p][key]
+	if !ok {
+		b.bytes += int64(len(key)) + recordOverhead
+	}
+	b.parts[p][key] = append(values, value)
+	b.bytes += int64(len(value)) + recordOverhead
+	if b.bytes <= b.limit {
+		return
+	}
+	// Spill unless combining leaves room for as many records again, so
+	// that a buffer the combiner barely shrinks is not combined again
+	// after every few records.
+	if b.err = b.combine(); b.err == nil && b.bytes > b.limit/2 {
+		b.err = b.spill()
+	}
+}
+
+// combine runs the combiner over the values of each buffered key, such as
+// the ones wordcount emits for every occurrence of a word, and recounts
+// the bytes they take.
+func (b *mapBuffer) combine() error {
+	if b.combiner == nil {
+		return nil
+	}
+	b.bytes = 0
+	for _, records := range b.parts {
+		for key, values := range records {
+			if len(values) > 1 {
+				err := b.combined(func(key string, combined []string) error {
+					values = combined
+					return nil
+				})(key, values)
+				if err != nil {
+					return err
+				}
+				records[key] = values
+			}
+			b.bytes += int64(len(key)) + recordOverhead
+			for _, v := range values {
+				b.bytes += int64(len(v)) + recordOverhead
+			}
+		}
+	}
+	return nil
+}
+
+// spill writes every partition's records to a new run and empties the
+// buffer.
+func (b *mapBuffer) spill() error {
+	log.Printf("Spilling %d bytes of records", b.bytes)
+	for p, records := range b.parts {
+		if len(records) == 0 {
+			continue
+		}
+		if err := b.writeRun(p, []recordReader{newSliceRecordReader(records)}); err != nil {
+			return err
+		}
+		b.parts[p] = make(map[string][]string)
+	}
+	b.bytes = 0
+	return nil
+}
+
+// writeRun merges readers into a new run of partition p.
+func (b *mapBuffer) writeRun(p int, readers []recordReader) error {
+	f, err := os.CreateTemp(b.dir, fmt.Sprintf("mapreduce-spill-p%d-*.mrr", p))
+	if err != nil {
+		return err
+	}
+	b.runs[p] = append(b.runs[p], f.Name())
+	w, err := newBinaryRecordWriter(f, CompressNone)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = mergeRecords(readers, b.combined(w.write))
+	if err == nil {
+		err = w.close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// merge merges partition p's runs and the records still in memory into
+// one sorted stream for fn, combining the values of each key. While
+// there are too many runs to open at once, it first merges them in
+// batches into fewer, larger runs.
+func (b *mapBuffer) merge(p int, fn func(key string, values []string) error) error {
+	for len(b.runs[p]) >= maxMergeRuns {
+		batch := b.runs[p][:maxMergeRuns]
+		b.runs[p] = b.runs[p][maxMergeRuns:]
+		err := b.mergeRuns(batch, func(readers []recordReader) error {
+			return b.writeRun(p, readers)
+		})
+		for _, name := range batch {
+			os.Remove(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return b.mergeRuns(b.runs[p], func(readers []recordReader) error {
+		readers = append([]recordReader{newSliceRecordReader(b.parts[p])}, readers...)
+		return mergeRecords(readers, b.combined(fn))
+	})
+}
+
+// mergeRuns opens the named runs and passes readers of them to merge.
+func (b *mapBuffer) mergeRuns(names []string, merge func(readers []recordReader) error) error {
+	var readers []recordReader
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, err := openRecordReader(f, name)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, r)
+	}
+	return merge(readers)
+}
+
+// combined wraps fn to first run the combiner, if any, over the values.
+func (b *mapBuffer) combined(fn func(key string, values []string) error) func(key string, values []string) error {
+	if b.combiner == nil {
+		return fn
+	}
+	return func(key string, values []string) error {
+		var combined []string
+		var err error
+		b.combiner.Reduce(key, slices.Values(values), func(k, v string) {
+			if k != key && err == nil {
+				err = fmt.Errorf("combiner emitted key %q for key %q", k, key)
+			}
+			combined = append(combined, v)
+		})
+		if err != nil {
+			return err
+		}
+		return fn(key, combined)
+	}
+}
+
+// close removes the spill files.
+func (b *mapBuffer) close() {
+	for _, runs := range b.runs {
+		for _, name := range runs {
+			os.Remove(name)
+		}
+	}
+}
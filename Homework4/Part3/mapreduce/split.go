@@ -0,0 +1,212 @@
+package mapreduce
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"storage"
+)
+
+// SplitOptions controls how Split cuts its input.
+type SplitOptions struct {
+	// Chunks is the number of chunks to write.
+	Chunks int
+	// ChunkBytes, if positive, is the target chunk size and overrides
+	// Chunks.
+	ChunkBytes int64
+	// Manifest is where the manifest is written. Empty means
+	// <output prefix>/manifest.json.
+	Manifest string
+}
+
+// Split cuts the object at input into chunks named chunk<n>.txt under
+// outputPrefix and writes a manifest describing them. The input is
+// streamed straight into the chunk uploads, so memory use does not depend
+// on its size. cfg configures the storage, with the multipart part size
+// picked by Split.
+func Split(ctx context.Context, cfg storage.Config, input, outputPrefix string, opts SplitOptions) (*Manifest, error) {
+	outputPrefix = strings.TrimSuffix(outputPrefix, "/")
+	manifestURL := opts.Manifest
+	if manifestURL == "" {
+		manifestURL = outputPrefix + "/manifest.json"
+	}
+	if opts.Chunks < 1 && opts.ChunkBytes <= 0 {
+		return nil, fmt.Errorf("need at least one chunk, got %d", opts.Chunks)
+	}
+
+	// Step 1: Open the input as a stream
+	in, err := storage.New(cfg).Get(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("downloading: %w", err)
+	}
+	defer in.Close()
+	size := in.Size
+
+	log.Printf("Streaming %d bytes", size)
+
+	n := opts.Chunks
+	if opts.ChunkBytes > 0 {
+		n = int(max(1, (size+opts.ChunkBytes-1)/opts.ChunkBytes))
+	}
+	// Chunks grow a little to finish lines, which PartSizeFor allows for.
+	cfg.PartSize = storage.PartSizeFor(size / int64(n))
+	return splitStream(ctx, in, input, storage.New(cfg), outputPrefix, manifestURL, n)
+}
+
+// splitStream cuts in, read from input, into n chunks in store and
+// writes the manifest to manifestURL.
+func splitStream(ctx context.Context, in *storage.Object, input string, store storage.Storage, outputPrefix, manifestURL string, n int) (*Manifest, error) {
+	size := in.Size
+
+	// Step 2: Copy the chunks straight from the input to their uploads
+	m := &Manifest{Input: input, TotalBytes: size}
+	s := &chunkSplitter{in: bufio.NewReaderSize(in, maxLineLookahead), size: size, n: n}
+	for s.pos < size {
+		c := Chunk{
+			Index:  len(m.Chunks) + 1,
+			Offset: s.pos,
+		}
+		c.URL = fmt.Sprintf("%s/chunk%d.txt", outputPrefix, c.Index)
+
+		pr, pw := io.Pipe()
+		uploaded := make(chan error, 1)
+		go func() {
+			err := store.Put(ctx, c.URL, pr)
+			pr.CloseWithError(err)
+			uploaded <- err
+		}()
+		cw := &countingWriter{w: pw}
+		err := s.next(cw)
+		pw.CloseWithError(err)
+		if uploadErr := <-uploaded; err == nil {
+			err = uploadErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("writing chunk %d: %w", c.Index, err)
+		}
+
+		c.Size, c.Lines = cw.n, cw.lines(s.pos == size)
+		log.Printf("✓ Uploaded: %s (%d bytes, %d lines)", c.URL, c.Size, c.Lines)
+
+		// Step 3: Describe the chunk in the manifest
+		m.Chunks = append(m.Chunks, c)
+		m.TotalLines += c.Lines
+	}
+
+	manifestJSON, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.PutBytes(ctx, store, manifestURL, manifestJSON); err != nil {
+		return nil, fmt.Errorf("uploading manifest: %w", err)
+	}
+	log.Printf("✓ Uploaded: %s", manifestURL)
+	return m, nil
+}
+
+// maxLineLookahead is how far past a cut the splitter looks for the end
+// of the line. It is also the size of the read buffer, so it bounds memory
+// together with the upload part buffers.
+const maxLineLookahead = 1 << 20
+
+// chunkSplitter cuts a stream of size bytes into at most n chunks of about
+// equal size. Each cut is moved forward to the end of its line, so lines
+// stay whole, and the ideal cuts it passes are dropped. Only a line longer
+// than maxLineLookahead is cut inside, after white space if there is any
+// in reach and otherwise on a UTF-8 character boundary.
+type chunkSplitter struct {
+	in   *bufio.Reader
+	size int64
+	n    int
+	pos  int64 // bytes of in consumed so far
+	cut  int   // next of the n-1 ideal cuts to consider
+}
+
+// next copies the next chunk to w.
+func (s *chunkSplitter) next(w io.Writer) error {
+	start := s.pos
+	for s.cut++; s.cut < s.n; s.cut++ {
+		target := s.size * int64(s.cut) / int64(s.n)
+		if target <= start {
+			continue
+		}
+
+		// Stop a few bytes short of the target so the cut can back up
+		// to the start of a UTF-8 sequence.
+		from := max(s.pos, target-utf8.UTFMax)
+		if err := s.copy(w, from-s.pos); err != nil {
+			return err
+		}
+		window, err := s.in.Peek(maxLineLookahead)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return err
+		}
+		rest := window[target-1-from:]
+
+		var cut int64
+		if j := bytes.IndexByte(rest, '\n'); j >= 0 {
+			cut = target + int64(j)
+		} else if err == io.EOF {
+			// The last line runs to the end of the input.
+			break
+		} else if j := bytes.IndexAny(rest, " \t\r\v\f"); j >= 0 {
+			cut = target + int64(j)
+		} else {
+			cut = target
+			for cut > from && !utf8.RuneStart(window[cut-from]) {
+				cut--
+			}
+		}
+		if cut >= s.size {
+			break
+		}
+		if cut > start {
+			return s.copy(w, cut-s.pos)
+		}
+	}
+	return s.copy(w, s.size-s.pos)
+}
+
+func (s *chunkSplitter) copy(w io.Writer, n int64) error {
+	copied, err := io.CopyN(w, s.in, n)
+	s.pos += copied
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingWriter counts the bytes and lines written through it.
+type countingWriter struct {
+	w        io.Writer
+	n        int64
+	newlines int
+	last     byte
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.newlines += bytes.Count(p[:n], []byte("\n"))
+	if n > 0 {
+		c.last = p[n-1]
+	}
+	return n, err
+}
+
+// lines counts the lines that end in the chunk: a line cut in two is
+// counted in the chunk with its end. The last chunk of the input also
+// counts a last line without a trailing newline.
+func (c *countingWriter) lines(last bool) int {
+	if last && c.n > 0 && c.last != '\n' {
+		return c.newlines + 1
+	}
+	return c.newlines
+}
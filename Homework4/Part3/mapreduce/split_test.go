@@ -0,0 +1,196 @@
+package mapreduce
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"storage"
+)
+
+// lineGenerator makes size bytes of text on the fly: lines of varying
+// length with some multi-byte characters, one very long line every so
+// often, and no trailing newline at the end.
+type lineGenerator struct {
+	size, pos int64
+	line      int
+	buf       []byte
+}
+
+func (g *lineGenerator) Read(p []byte) (int, error) {
+	if g.pos >= g.size {
+		return 0, io.EOF
+	}
+	for len(g.buf) < len(p) {
+		g.line++
+		words := 1 + g.line%23
+		if g.line%50000 == 0 {
+			// Longer than maxLineLookahead, so it has to be cut inside.
+			words = 2 * maxLineLookahead / 6
+		}
+		for i := range words {
+			if i > 0 {
+				g.buf = append(g.buf, ' ')
+			}
+			g.buf = append(g.buf, []string{"alpha", "béta", "γάμμα", "delta", "ε"}[(g.line+i)%5]...)
+		}
+		g.buf = append(g.buf, '\n')
+	}
+	n := copy(p, g.buf[:min(int64(len(p)), g.size-g.pos)])
+	g.buf = g.buf[:copy(g.buf, g.buf[n:])]
+	g.pos += int64(n)
+	return n, nil
+}
+
+// countingStorage keeps only what it needs to check the chunks: their
+// sizes, line counts and a checksum of them all in order.
+type countingStorage struct {
+	mu       sync.Mutex
+	sizes    []int64
+	newlines int
+	// cutWords counts chunks that end inside a word.
+	cutWords int
+	crc      uint32
+	manifest []byte
+}
+
+func (s *countingStorage) Get(_ context.Context, url string) (*storage.Object, error) {
+	return nil, fmt.Errorf("%s: %w", url, storage.ErrNotFound)
+}
+
+func (s *countingStorage) List(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func (s *countingStorage) Put(_ context.Context, url string, r io.Reader) error {
+	if strings.HasSuffix(url, "/manifest.json") {
+		b, err := io.ReadAll(r)
+		s.manifest = b
+		return err
+	}
+	var size int64
+	var newlines int
+	var last byte
+	crc := s.crc
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := r.Read(buf)
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:n])
+		newlines += bytes.Count(buf[:n], []byte("\n"))
+		size += int64(n)
+		if n > 0 {
+			last = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sizes = append(s.sizes, size)
+	s.newlines += newlines
+	if last != '\n' && last != ' ' {
+		s.cutWords++
+	}
+	s.crc = crc
+	return nil
+}
+
+// TestSplitMemory splits a generated multi-gigabyte input and checks
+// that the heap stays small while the chunks come out whole.
+func TestSplitMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("splits 3 GiB; skipped with -short")
+	}
+	const (
+		size   = 3 << 30
+		chunks = 7
+		// The read buffer and a part buffer per upload, with room for
+		// the garbage collector.
+		heapLimit = 32 << 20
+	)
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(heapLimit))
+
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var ms runtime.MemStats
+		for {
+			runtime.ReadMemStats(&ms)
+			peak = max(peak, ms.HeapAlloc)
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}()
+
+	gen := &lineGenerator{size: size}
+	input := &hashingGenerator{r: gen}
+	store := &countingStorage{}
+	m, err := splitStream(t.Context(), &storage.Object{ReadCloser: io.NopCloser(input), Size: size},
+		"gen://input", store, "count://out", "count://out/manifest.json", chunks)
+	close(done)
+	<-sampled
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("peak heap %.1f MiB, chunk sizes %v", float64(peak)/(1<<20), store.sizes)
+	if peak > heapLimit {
+		t.Errorf("peak heap %d bytes, want at most %d", peak, heapLimit)
+	}
+	if store.crc != input.crc {
+		t.Error("the chunks put together differ from the input")
+	}
+	if len(m.Chunks) != chunks || len(store.sizes) != chunks {
+		t.Fatalf("%d chunks in the manifest, %d uploaded; want %d", len(m.Chunks), len(store.sizes), chunks)
+	}
+	var total int64
+	for i, c := range m.Chunks {
+		if c.Size != store.sizes[i] {
+			t.Errorf("chunk %d: manifest says %d bytes, uploaded %d", c.Index, c.Size, store.sizes[i])
+		}
+		total += c.Size
+	}
+	if total != size || m.TotalBytes != size {
+		t.Errorf("chunks add up to %d bytes, manifest total %d; want %d", total, m.TotalBytes, size)
+	}
+	// The input ends without a newline, so its last line is counted
+	// as well.
+	if want := store.newlines + 1; m.TotalLines != want {
+		t.Errorf("manifest counts %d lines, want %d", m.TotalLines, want)
+	}
+	// Only the last chunk ends mid-word, at the end of the input.
+	if store.cutWords != 1 {
+		t.Errorf("%d chunks end inside a word, want 1", store.cutWords)
+	}
+	if len(store.manifest) == 0 {
+		t.Error("no manifest was written")
+	}
+}
+
+// hashingGenerator checksums what is read through it.
+type hashingGenerator struct {
+	r   io.Reader
+	crc uint32
+}
+
+func (h *hashingGenerator) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.crc = crc32.Update(h.crc, crc32.IEEETable, p[:n])
+	return n, err
+}
@@ -0,0 +1,160 @@
+package mapreduce
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/cases"
+)
+
+// tokenizerParams are the parameters of the jobs that split lines into
+// words, wordcount and index. JobFlags.RegisterTokenizerFlags sets them
+// from flags of the same names.
+var tokenizerParams = []struct{ name, usage string }{
+	{"tokenizer", "`kind` of tokenizer: unicode splits lines at Unicode word boundaries (UAX #29), simple at white space, trimming ASCII punctuation (default unicode)"},
+	{"case", "case `folding`: lower, fold for full Unicode case folding, or none (default lower)"},
+	{"stopwords", "`list` of words to leave out: english, or a file of words separated by white space (default none)"},
+	{"stem", "`stemmer`: english, the Snowball English stemmer, which also lower-cases, or none (default none)"},
+	{"ngram", "count runs of `n` words rather than single words, such as 2 for bigrams (default 1)"},
+}
+
+func tokenizerParamNames() []string {
+	names := make([]string, len(tokenizerParams))
+	for i, p := range tokenizerParams {
+		names[i] = p.name
+	}
+	return names
+}
+
+// RegisterTokenizerFlags adds a flag for each tokenizer parameter of the
+// wordcount and index jobs, which sets the parameter.
+func (f *JobFlags) RegisterTokenizerFlags(fs *flag.FlagSet) {
+	if f.Params == nil {
+		f.Params = make(Params)
+	}
+	for _, p := range tokenizerParams {
+		fs.Func(p.name, p.usage, func(value string) error {
+			f.Params[p.name] = value
+			return nil
+		})
+	}
+}
+
+// tokenizer splits lines into the words, or n-grams of words, that
+// wordcount counts and index lists.
+type tokenizer struct {
+	unicode   bool
+	fold      func(string) string
+	stopwords func(string) bool // after folding, before stemming
+	stem      bool
+	ngram     int
+}
+
+func newTokenizer(params Params) (*tokenizer, error) {
+	t := &tokenizer{fold: strings.ToLower, ngram: 1}
+	switch params["tokenizer"] {
+	case "", "unicode":
+		t.unicode = true
+	case "simple":
+	default:
+		return nil, fmt.Errorf("unknown tokenizer %q: want unicode or simple", params["tokenizer"])
+	}
+
+	switch params["case"] {
+	case "", "lower":
+	case "fold":
+		// A Caser keeps state, so each call gets its own.
+		t.fold = func(s string) string { return cases.Fold().String(s) }
+	case "none":
+		t.fold = func(s string) string { return s }
+	default:
+		return nil, fmt.Errorf("unknown case %q: want lower, fold or none", params["case"])
+	}
+
+	switch name := params["stopwords"]; name {
+	case "", "none":
+	case "english":
+		t.stopwords = english.IsStopWord
+	default:
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading stopwords: %w", err)
+		}
+		stop := make(map[string]bool)
+		for _, word := range strings.Fields(string(b)) {
+			stop[t.fold(word)] = true
+		}
+		t.stopwords = func(word string) bool { return stop[word] }
+	}
+
+	switch params["stem"] {
+	case "", "none":
+	case "english":
+		t.stem = true
+	default:
+		return nil, fmt.Errorf("unknown stemmer %q: want english or none", params["stem"])
+	}
+
+	if s := params["ngram"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("ngram %q is not a positive number", s)
+		}
+		t.ngram = n
+	}
+	return t, nil
+}
+
+// words splits text into words, folded, without stopwords and stemmed
+// as t says, then joins each run of t.ngram of them with spaces. N-grams
+// do not span lines.
+func (t *tokenizer) words(text string) []string {
+	var words []string
+	add := func(word string) {
+		word = t.fold(word)
+		if word == "" || t.stopwords != nil && t.stopwords(word) {
+			return
+		}
+		if t.stem {
+			word = english.Stem(word, true)
+		}
+		words = append(words, word)
+	}
+
+	if t.unicode {
+		// Keep the segments with a letter or digit in them, dropping
+		// spaces and punctuation. A typographic apostrophe counts as
+		// a plain one, so "hamlet’s" and "hamlet's" are one word.
+		state := -1
+		for text != "" {
+			var word string
+			word, text, state = uniseg.FirstWordInString(text, state)
+			if strings.IndexFunc(word, isWordRune) >= 0 {
+				add(strings.ReplaceAll(word, "’", "'"))
+			}
+		}
+	} else {
+		for _, word := range strings.Fields(text) {
+			add(strings.Trim(word, ".,!?;:\"'()[]"))
+		}
+	}
+
+	if t.ngram == 1 {
+		return words
+	}
+	var grams []string
+	for i := t.ngram; i <= len(words); i++ {
+		grams = append(grams, strings.Join(words[i-t.ngram:i], " "))
+	}
+	return grams
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -1,133 +1,109 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"mapreduce"
+	"storage"
 )
 
 func main() {
-	// Validate arguments
-	// Example: reducer result1.json result2.json result3.json final.json
-	if len(os.Args) < 3 {
+	manifestURL := flag.String("manifest", "", "splitter manifest; reduces one mapper result per chunk")
+	resultsPrefix := flag.String("results", "", "prefix of the result<n>.json files (default: the manifest's directory)")
+	resultsExt := flag.String("results-ext", ".json", "with -manifest, extension of the mapper results, .json or .mrr for binary")
+	partition := flag.Int("partition", -1, "with -manifest, reduce this partition of partitioned mapper results, result<n>-p<partition>.json")
+	concat := flag.Bool("concat", false, "join the results of reducers for different partitions instead of adding up counts")
+	var opts mapreduce.ReduceOptions
+	opts.Encoding.RegisterFlags(flag.CommandLine)
+	opts.Report.RegisterFlags(flag.CommandLine)
+	var jobFlags mapreduce.JobFlags
+	jobFlags.RegisterFlags(flag.CommandLine)
+	storeCfg := storage.DefaultConfig()
+	storeCfg.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
 		fmt.Println("Usage: reducer <result1-url> <result2-url> ... <output-url>")
+		fmt.Println("       reducer -manifest <manifest-url> [-results <prefix>] [-partition <p>] <output-url>")
+		fmt.Println("       reducer -concat <part1-url> <part2-url> ... <output-url>")
 		fmt.Println("Example: reducer s3://bucket/result1.json s3://bucket/result2.json s3://bucket/final.json")
-		os.Exit(1)
+		fmt.Println("Example: reducer -manifest s3://bucket/chunks/manifest.json -results s3://bucket s3://bucket/final.json")
+		fmt.Println("Example: reducer -top 100 -csv s3://bucket/result1.json s3://bucket/result2.json s3://bucket/top100.csv")
+		fmt.Println("Inputs may be JSON or binary records in any mix; -format sets the format of the output.")
+		flag.PrintDefaults()
+		fmt.Print("\nJobs:\n" + mapreduce.JobUsage())
 	}
+	flag.Parse()
 
-	// The last argument is the output URL
-	outputURL := os.Args[len(os.Args)-1]
-
-	// All previous arguments are input URLs
-	inputURLs := os.Args[1 : len(os.Args)-1]
-
-	log.Printf("Input files: %d", len(inputURLs))
-	log.Printf("Output: %s", outputURL)
-
-	// Accumulated word counts
-	finalCount := make(map[string]int)
+	job, err := jobFlags.Job()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := opts.Encoding.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := opts.Report.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if *concat && opts.Report.Enabled() {
+		log.Fatal("-concat joins outputs as they are; -top, -csv and -stats need a reduce")
+	}
+	args := flag.Args()
 
-	// Download and merge each result
-	for i, url := range inputURLs {
-		log.Printf("Processing %d: %s", i+1, url)
+	ctx := context.Background()
+	store := storage.New(storeCfg)
 
-		// Download JSON
-		jsonStr, err := downloadFromS3(url)
-		if err != nil {
-			log.Fatalf("Error downloading %s: %v", url, err)
+	// Validate arguments
+	// Example: reducer result1.json result2.json result3.json final.json
+	var inputURLs []string
+	var outputURL string
+	switch {
+	case *manifestURL == "" && len(args) >= 2:
+		// The last argument is the output URL; all previous arguments
+		// are input URLs
+		outputURL = args[len(args)-1]
+		inputURLs = args[:len(args)-1]
+	case *manifestURL != "" && len(args) == 1 && !*concat:
+		outputURL = args[0]
+		prefix := *resultsPrefix
+		if prefix == "" {
+			// Not path.Dir, which would turn s3://bucket into s3:/bucket.
+			prefix = "."
+			if i := strings.LastIndex(*manifestURL, "/"); i >= 0 {
+				prefix = (*manifestURL)[:i]
+			}
 		}
-
-		// Parse JSON
-		var count map[string]int
-		err = json.Unmarshal([]byte(jsonStr), &count)
+		m, err := mapreduce.ReadManifest(ctx, store, *manifestURL)
 		if err != nil {
-			log.Fatalf("Error parsing JSON: %v", err)
+			log.Fatalf("Error reading manifest: %v", err)
 		}
-
-		log.Printf("  Words in this file: %d", len(count))
-
-		// Merge into finalCount
-		for word, cnt := range count {
-			finalCount[word] += cnt
+		if len(m.Chunks) == 0 {
+			log.Fatalf("Error reading manifest: %s lists no chunks", *manifestURL)
+		}
+		inputURLs = mapreduce.ResultURLs(m, strings.TrimSuffix(prefix, "/"), *resultsExt)
+		if *partition >= 0 {
+			for i, url := range inputURLs {
+				inputURLs[i] = mapreduce.PartitionURL(url, *partition)
+			}
 		}
+	default:
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	log.Printf("Total unique words: %d", len(finalCount))
-	log.Printf("Final count: %v", finalCount)
-
-	// Convert to JSON
-	finalJSON, err := json.Marshal(finalCount)
-	if err != nil {
-		log.Fatalf("Error marshaling final JSON: %v", err)
-	}
+	log.Printf("Input files: %d", len(inputURLs))
+	log.Printf("Output: %s", outputURL)
 
-	// Upload final result
-	err = uploadToS3(outputURL, string(finalJSON))
-	if err != nil {
-		log.Fatalf("Error uploading: %v", err)
+	if *concat {
+		if err := mapreduce.Concat(ctx, store, inputURLs, outputURL); err != nil {
+			log.Fatalf("Error concatenating: %v", err)
+		}
+	} else if _, err := mapreduce.Reduce(ctx, store, job, inputURLs, outputURL, opts); err != nil {
+		log.Fatalf("Error reducing: %v", err)
 	}
 
 	log.Printf("✓ Success! Final result saved to %s", outputURL)
 }
-
-// --- S3 download ---
-func downloadFromS3(s3URL string) (string, error) {
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String("us-west-2"),
-	}))
-
-	downloader := s3manager.NewDownloader(sess)
-
-	s3URL = strings.TrimPrefix(s3URL, "s3://")
-	parts := strings.SplitN(s3URL, "/", 2)
-
-	bucket := parts[0]
-	key := parts[1]
-
-	buff := &aws.WriteAtBuffer{}
-
-	_, err := downloader.Download(buff, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-
-	if err != nil {
-		return "", err
-	}
-
-	return string(buff.Bytes()), nil
-}
-
-// --- S3 upload ---
-func uploadToS3(s3URL, content string) error {
-	sess := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String("us-west-2"),
-	}))
-
-	uploader := s3manager.NewUploader(sess)
-
-	s3URL = strings.TrimPrefix(s3URL, "s3://")
-	parts := strings.SplitN(s3URL, "/", 2)
-
-	bucket := parts[0]
-	key := parts[1]
-
-	log.Printf("Uploading: bucket=%s, key=%s", bucket, key)
-
-	reader := strings.NewReader(content)
-
-	_, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   reader,
-	})
-
-	return err
-}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fileStorage keeps objects as files. URLs are file:// followed by a path,
+// or just a path.
+type fileStorage struct{}
+
+func filePath(url string) string {
+	return filepath.FromSlash(strings.TrimPrefix(url, "file://"))
+}
+
+func (fileStorage) Get(_ context.Context, url string) (*Object, error) {
+	f, err := os.Open(filePath(url))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", url, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// A directory is only a prefix of objects, as in S3.
+	if info.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", url, ErrNotFound)
+	}
+	return &Object{ReadCloser: f, Size: info.Size()}, nil
+}
+
+// Put writes to a temporary file first so a reader never sees half an
+// object.
+func (fileStorage) Put(_ context.Context, url string, r io.Reader) error {
+	path := filePath(url)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (fileStorage) List(_ context.Context, prefix string) ([]string, error) {
+	// Compare against cleaned paths, since that is what WalkDir yields.
+	path := filepath.Clean(filePath(prefix))
+	root := filepath.Dir(path)
+	if strings.HasSuffix(prefix, "/") {
+		root = path
+		path += string(filepath.Separator)
+	}
+
+	var urls []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != root && !strings.HasPrefix(p, path) && !strings.HasPrefix(path, p+string(filepath.Separator)) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !strings.HasPrefix(p, path) || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		// Give the URLs back in the form they were asked for.
+		urls = append(urls, prefix+filepath.ToSlash(p[len(path):]))
+		return nil
+	})
+	slices.Sort(urls)
+	return urls, err
+}
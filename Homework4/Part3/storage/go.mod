@@ -0,0 +1,7 @@
+module storage
+
+go 1.25.5
+
+require github.com/aws/aws-sdk-go v1.49.0
+
+require github.com/jmespath/go-jmespath v0.4.0 // indirect
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Memory is the process-wide store behind mem:// URLs.
+var Memory = NewMemory()
+
+// MemoryStorage keeps objects in memory under their full URL. It accepts
+// URLs of any scheme, so a test can stand it in for S3.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+// NewMemory returns an empty MemoryStorage.
+func NewMemory() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string][]byte)}
+}
+
+func (m *MemoryStorage) Get(_ context.Context, url string) (*Object, error) {
+	m.mu.RLock()
+	data, ok := m.objects[url]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", url, ErrNotFound)
+	}
+	// Stored slices are never modified, so readers can share them.
+	return &Object{ReadCloser: io.NopCloser(bytes.NewReader(data)), Size: int64(len(data))}, nil
+}
+
+func (m *MemoryStorage) Put(_ context.Context, url string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.objects[url] = data
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryStorage) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.RLock()
+	var urls []string
+	for url := range m.objects {
+		if strings.HasPrefix(url, prefix) {
+			urls = append(urls, url)
+		}
+	}
+	m.mu.RUnlock()
+	slices.Sort(urls)
+	return urls, nil
+}
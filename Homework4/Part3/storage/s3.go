@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// s3Storage keeps objects in S3. URLs are s3://bucket/key.
+type s3Storage struct {
+	cfg Config
+	// sess is created on first use, so commands that never touch S3 do
+	// not need AWS credentials.
+	sess func() *session.Session
+}
+
+func newS3(cfg Config) *s3Storage {
+	return &s3Storage{cfg: cfg, sess: sync.OnceValue(func() *session.Session {
+		awsCfg := &aws.Config{Region: aws.String(cfg.Region)}
+		if cfg.Endpoint != "" {
+			awsCfg.Endpoint = aws.String(cfg.Endpoint)
+			awsCfg.S3ForcePathStyle = aws.Bool(true)
+		}
+		return session.Must(session.NewSession(awsCfg))
+	})}
+}
+
+// PartSizeFor returns a multipart part size that leaves room for objects
+// of about objectSize bytes to grow to twice that within the S3 limit on
+// the number of parts.
+func PartSizeFor(objectSize int64) int64 {
+	return max(s3manager.MinUploadPartSize, objectSize/(s3manager.MaxUploadParts/2))
+}
+
+// parseS3URL splits "s3://bucket/path/file.txt" into its bucket and key.
+func parseS3URL(url string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(url, "s3://")
+	bucket, key, _ = strings.Cut(rest, "/")
+	if !ok || bucket == "" {
+		return "", "", fmt.Errorf("%s: not an s3://bucket/key URL", url)
+	}
+	return bucket, key, nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, url string) (*Object, error) {
+	bucket, key, err := parseS3URL(url)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s3.New(s.sess()).GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, fmt.Errorf("%s: %w", url, ErrNotFound)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return &Object{ReadCloser: out.Body, Size: aws.Int64Value(out.ContentLength)}, nil
+}
+
+// Put streams r to S3, switching to a multipart upload once it outgrows
+// one part, so memory use does not depend on the object size.
+func (s *s3Storage) Put(ctx context.Context, url string, r io.Reader) error {
+	bucket, key, err := parseS3URL(url)
+	if err != nil {
+		return err
+	}
+	uploader := s3manager.NewUploader(s.sess(), func(u *s3manager.Uploader) {
+		u.PartSize = max(s3manager.MinUploadPartSize, s.cfg.PartSize)
+	})
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", url, err)
+	}
+	return nil
+}
+
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	bucket, keyPrefix, err := parseS3URL(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	err = s3.New(s.sess()).ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(keyPrefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			urls = append(urls, "s3://"+bucket+"/"+aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", prefix, err)
+	}
+	return urls, nil
+}
@@ -0,0 +1,135 @@
+// Package storage reads and writes the MapReduce inputs, chunks and
+// results. Objects are named by URL and the scheme picks the backend:
+//
+//	s3://bucket/key      Amazon S3 or an S3-compatible server
+//	file:///path/to/file the local filesystem; a URL without a scheme is a
+//	                     local path too
+//	mem://name           an in-memory store shared by the whole process,
+//	                     for tests and in-process runs
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for an object that does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// Storage is a flat namespace of objects named by URL.
+type Storage interface {
+	// Get opens the object at url for reading.
+	Get(ctx context.Context, url string) (*Object, error)
+	// Put stores everything read from r as the object at url, replacing
+	// any object already there.
+	Put(ctx context.Context, url string, r io.Reader) error
+	// List returns the URLs of all objects whose URL starts with prefix,
+	// in lexical order.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Object is an object being read. The caller must close it.
+type Object struct {
+	io.ReadCloser
+	// Size is the length of the object in bytes.
+	Size int64
+}
+
+// Config configures the S3 backend.
+type Config struct {
+	// Region is the AWS region of the buckets.
+	Region string
+	// Endpoint replaces the AWS endpoint, for example with a local
+	// S3-compatible server such as http://localhost:9000. Buckets are
+	// then addressed by path instead of by host name.
+	Endpoint string
+	// PartSize is the part size of multipart uploads. Zero uses the
+	// smallest part size S3 allows.
+	PartSize int64
+}
+
+// DefaultConfig returns the configuration from the AWS_REGION and
+// AWS_ENDPOINT_URL environment variables, with us-west-2 as the region if
+// none is set.
+func DefaultConfig() Config {
+	cfg := Config{Region: "us-west-2", Endpoint: os.Getenv("AWS_ENDPOINT_URL")}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		cfg.Region = region
+	}
+	return cfg
+}
+
+// RegisterFlags adds -s3-region and -s3-endpoint flags that set cfg.
+func (cfg *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Region, "s3-region", cfg.Region, "AWS `region` of the S3 buckets")
+	fs.StringVar(&cfg.Endpoint, "s3-endpoint", cfg.Endpoint, "S3-compatible endpoint `URL` to use instead of AWS")
+}
+
+// New returns a Storage that dispatches on the URL scheme, with the S3
+// backend configured by cfg.
+func New(cfg Config) Storage {
+	return mux{
+		"s3":   newS3(cfg),
+		"file": fileStorage{},
+		"mem":  Memory,
+	}
+}
+
+type mux map[string]Storage
+
+func (m mux) backend(url string) (Storage, error) {
+	scheme, _, ok := strings.Cut(url, "://")
+	if !ok {
+		return fileStorage{}, nil
+	}
+	s, ok := m[scheme]
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported storage scheme %q", url, scheme)
+	}
+	return s, nil
+}
+
+func (m mux) Get(ctx context.Context, url string) (*Object, error) {
+	s, err := m.backend(url)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, url)
+}
+
+func (m mux) Put(ctx context.Context, url string, r io.Reader) error {
+	s, err := m.backend(url)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, url, r)
+}
+
+func (m mux) List(ctx context.Context, prefix string) ([]string, error) {
+	s, err := m.backend(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return s.List(ctx, prefix)
+}
+
+// GetBytes reads the whole object at url.
+func GetBytes(ctx context.Context, s Storage, url string) ([]byte, error) {
+	obj, err := s.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return io.ReadAll(obj)
+}
+
+// PutBytes stores data as the object at url.
+func PutBytes(ctx context.Context, s Storage, url string, data []byte) error {
+	return s.Put(ctx, url, bytes.NewReader(data))
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestRoundTrip puts, gets and lists objects through New's scheme
+// dispatch for each local backend.
+func TestRoundTrip(t *testing.T) {
+	s := New(DefaultConfig())
+	dir := filepath.ToSlash(t.TempDir())
+	bases := map[string]string{
+		"file": "file://" + dir + "/file",
+		"path": dir + "/path",
+		// Memory is shared by the process, so keep to a name of our own.
+		"mem": "mem://" + t.Name(),
+	}
+	for name, base := range bases {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			objects := map[string]string{
+				base + "/a/1":    "one",
+				base + "/a/2":    "two",
+				base + "/a/b/3":  "three",
+				base + "/ab.txt": "",
+				base + "/c":      "see",
+			}
+			for url, data := range objects {
+				if err := PutBytes(ctx, s, url, []byte(data)); err != nil {
+					t.Fatalf("Put(%s): %v", url, err)
+				}
+			}
+			// Put replaces.
+			objects[base+"/c"] = "sea"
+			if err := PutBytes(ctx, s, base+"/c", []byte("sea")); err != nil {
+				t.Fatal(err)
+			}
+
+			for url, want := range objects {
+				obj, err := s.Get(ctx, url)
+				if err != nil {
+					t.Fatalf("Get(%s): %v", url, err)
+				}
+				obj.Close()
+				if obj.Size != int64(len(want)) {
+					t.Errorf("Get(%s).Size = %d, want %d", url, obj.Size, len(want))
+				}
+				if got, err := GetBytes(ctx, s, url); err != nil || string(got) != want {
+					t.Errorf("GetBytes(%s) = %q, %v; want %q", url, got, err, want)
+				}
+			}
+
+			for _, url := range []string{base + "/missing", base + "/a", base + "/nope/1"} {
+				if _, err := s.Get(ctx, url); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Get(%s) error = %v, want ErrNotFound", url, err)
+				}
+			}
+
+			tests := []struct {
+				prefix string
+				want   []string
+			}{
+				{"/a/", []string{"/a/1", "/a/2", "/a/b/3"}},
+				{"/a", []string{"/a/1", "/a/2", "/a/b/3", "/ab.txt"}},
+				{"/a/b", []string{"/a/b/3"}},
+				{"/c", []string{"/c"}},
+				{"/x", nil},
+				{"/x/", nil},
+			}
+			for _, tt := range tests {
+				got, err := s.List(ctx, base+tt.prefix)
+				if err != nil {
+					t.Fatalf("List(%s): %v", base+tt.prefix, err)
+				}
+				var want []string
+				for _, w := range tt.want {
+					want = append(want, base+w)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("List(%s) = %v, want %v", base+tt.prefix, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestDispatch checks that each scheme reaches its backend.
+func TestDispatch(t *testing.T) {
+	s := New(DefaultConfig())
+	ctx := t.Context()
+
+	path := filepath.Join(t.TempDir(), "object")
+	if err := PutBytes(ctx, s, "file://"+filepath.ToSlash(path), []byte("on disk")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "on disk" {
+		t.Errorf("file:// object on disk = %q, %v", got, err)
+	}
+
+	url := "mem://" + t.Name() + "/object"
+	if err := PutBytes(ctx, s, url, []byte("in memory")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetBytes(ctx, Memory, url); err != nil || string(got) != "in memory" {
+		t.Errorf("mem:// object in Memory = %q, %v", got, err)
+	}
+}
+
+func TestBadURLs(t *testing.T) {
+	s := New(DefaultConfig())
+	ctx := t.Context()
+	tests := []struct {
+		url, want string
+	}{
+		{"gs://bucket/key", `unsupported storage scheme "gs"`},
+		{"://key", `unsupported storage scheme ""`},
+		// Malformed S3 URLs fail before any request is made.
+		{"s3:///key", "not an s3://bucket/key URL"},
+		{"s3://", "not an s3://bucket/key URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			check := func(op string, err error) {
+				t.Helper()
+				if err == nil || !strings.Contains(err.Error(), tt.want) || errors.Is(err, ErrNotFound) {
+					t.Errorf("%s(%s) error = %v, want one mentioning %q", op, tt.url, err, tt.want)
+				}
+			}
+			_, err := s.Get(ctx, tt.url)
+			check("Get", err)
+			check("Put", PutBytes(ctx, s, tt.url, []byte("x")))
+			_, err = s.List(ctx, tt.url)
+			check("List", err)
+		})
+	}
+}
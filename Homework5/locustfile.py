@@ -1,10 +1,14 @@
 from locust import HttpUser, task, between
 from locust.contrib.fasthttp import FastHttpUser
+import os
 import random
 import json
 
 PRODUCT_COUNT = 50
 
+# Set API_KEY when the server runs with AUTH_API_KEYS_FILE (needs a writer key)
+AUTH_HEADERS = {"X-API-Key": os.environ["API_KEY"]} if os.environ.get("API_KEY") else {}
+
 
 def make_product(pid):
     return {
@@ -23,6 +27,7 @@ class ProductHttpUser(HttpUser):
 
     def on_start(self):
         """Pre-populate products so GET requests don't 404"""
+        self.client.headers.update(AUTH_HEADERS)
         for pid in range(1, PRODUCT_COUNT + 1):
             self.client.post(
                 f"/products/{pid}/details",
@@ -53,6 +58,7 @@ class ProductHttpUser(HttpUser):
 # ==================== FastHttpUser ====================
 class ProductFastHttpUser(FastHttpUser):
     wait_time = between(1, 3)
+    default_headers = AUTH_HEADERS
 
     def on_start(self):
         for pid in range(1, PRODUCT_COUNT + 1):
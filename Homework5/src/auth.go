@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== Authentication ====================
+
+// Role is an authorization level. Each role includes the ones below it:
+// admin > writer > reader.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleReader
+	RoleWriter
+	RoleAdmin
+)
+
+func parseRole(s string) (Role, bool) {
+	switch strings.ToLower(s) {
+	case "reader":
+		return RoleReader, true
+	case "writer":
+		return RoleWriter, true
+	case "admin":
+		return RoleAdmin, true
+	}
+	return RoleNone, false
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleReader:
+		return "reader"
+	case RoleWriter:
+		return "writer"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Role    Role
+}
+
+type principalKey struct{}
+
+func principalFrom(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// apiKeyEntry is one element of the AUTH_API_KEYS_FILE JSON array.
+type apiKeyEntry struct {
+	Key     string `json:"key"`
+	Subject string `json:"subject"`
+	Role    string `json:"role"`
+}
+
+// jwk is the subset of RFC 7517 used here: "oct" keys for HS256 and
+// "RSA" keys for RS256.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type verificationKey struct {
+	kid    string
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// Authenticator validates static API keys and HS256/RS256 JWTs.
+type Authenticator struct {
+	disabled bool // AUTH_DISABLED: every request is treated as admin
+	apiKeys  map[[sha256.Size]byte]Principal
+	jwtKeys  []verificationKey
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+var (
+	errMissingCredentials = errors.New("no credentials provided")
+	errInvalidAPIKey      = errors.New("invalid API key")
+)
+
+// loadAuthenticator reads the API keys and JWKS from AUTH_API_KEYS and
+// AUTH_JWKS or the files named by AUTH_API_KEYS_FILE and AUTH_JWKS_FILE,
+// as well as AUTH_JWT_ISSUER, AUTH_JWT_AUDIENCE and AUTH_DISABLED. It
+// fails closed: with neither keys nor JWKS the server exits, unless
+// AUTH_DISABLED=true explicitly lets every request through as admin.
+func loadAuthenticator() *Authenticator {
+	a := &Authenticator{
+		apiKeys:  make(map[[sha256.Size]byte]Principal),
+		issuer:   os.Getenv("AUTH_JWT_ISSUER"),
+		audience: os.Getenv("AUTH_JWT_AUDIENCE"),
+		leeway:   30 * time.Second,
+	}
+
+	if v := os.Getenv("AUTH_DISABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			fatal("Invalid AUTH_DISABLED", "value", v)
+		}
+		a.disabled = b
+	}
+	keys, keysSource, err := authConfig("AUTH_API_KEYS")
+	if err != nil {
+		fatal("Error loading API keys", "error", err)
+	}
+	jwks, jwksSource, err := authConfig("AUTH_JWKS")
+	if err != nil {
+		fatal("Error loading JWKS", "error", err)
+	}
+	switch {
+	case a.disabled && (keysSource != "" || jwksSource != ""):
+		fatal("AUTH_DISABLED=true cannot be combined with API keys or a JWKS")
+	case a.disabled:
+		slog.Warn("Authentication disabled by AUTH_DISABLED; every request is treated as admin")
+		return a
+	case keysSource == "" && jwksSource == "":
+		fatal("No credentials configured; set AUTH_API_KEYS[_FILE] or AUTH_JWKS[_FILE], or AUTH_DISABLED=true for local development")
+	}
+
+	if keysSource != "" {
+		if err := a.loadAPIKeys(keys, keysSource); err != nil {
+			fatal("Error loading API keys", "error", err)
+		}
+	}
+	if jwksSource != "" {
+		if err := a.loadJWKS(jwks, jwksSource); err != nil {
+			fatal("Error loading JWKS", "error", err)
+		}
+	}
+	slog.Info("Authentication enabled", "api_keys", len(a.apiKeys), "jwt_keys", len(a.jwtKeys))
+	return a
+}
+
+// authConfig returns the contents of the environment variable name, which
+// is how ECS passes a secret, or else of the file named by name_FILE,
+// along with where they came from. source is empty if neither is set.
+func authConfig(name string) (data []byte, source string, err error) {
+	value, path := os.Getenv(name), os.Getenv(name+"_FILE")
+	switch {
+	case value != "" && path != "":
+		return nil, "", fmt.Errorf("set %s or %s_FILE, not both", name, name)
+	case value != "":
+		return []byte(value), name, nil
+	case path != "":
+		data, err := os.ReadFile(path)
+		return data, path, err
+	}
+	return nil, "", nil
+}
+
+func (a *Authenticator) loadAPIKeys(data []byte, source string) error {
+	var entries []apiKeyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	for i, e := range entries {
+		role, ok := parseRole(e.Role)
+		if e.Key == "" || e.Subject == "" || !ok {
+			return fmt.Errorf("%s: entry %d needs key, subject and role reader|writer|admin", source, i)
+		}
+		a.apiKeys[sha256.Sum256([]byte(e.Key))] = Principal{Subject: e.Subject, Role: role}
+	}
+	return nil
+}
+
+func (a *Authenticator) loadJWKS(data []byte, source string) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	for i, k := range set.Keys {
+		switch k.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return fmt.Errorf("%s: key %d: invalid \"k\"", source, i)
+			}
+			a.jwtKeys = append(a.jwtKeys, verificationKey{kid: k.Kid, alg: "HS256", secret: secret})
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 {
+				return fmt.Errorf("%s: key %d: invalid \"n\" or \"e\"", source, i)
+			}
+			pub := &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+			a.jwtKeys = append(a.jwtKeys, verificationKey{kid: k.Kid, alg: "RS256", public: pub})
+		default:
+			return fmt.Errorf("%s: key %d: unsupported kty %q", source, i, k.Kty)
+		}
+		if k.Alg != "" && k.Alg != a.jwtKeys[len(a.jwtKeys)-1].alg {
+			return fmt.Errorf("%s: key %d: alg %q does not match kty %q", source, i, k.Alg, k.Kty)
+		}
+	}
+	return nil
+}
+
+// Authenticate returns the principal for r's credentials. API keys are read
+// from X-API-Key, JWTs from "Authorization: Bearer <token>".
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		p, ok := a.apiKeys[sha256.Sum256([]byte(key))]
+		if !ok {
+			return Principal{}, errInvalidAPIKey
+		}
+		return p, nil
+	}
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		scheme, token, ok := strings.Cut(authz, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return Principal{}, errors.New("Authorization header must be \"Bearer <token>\"")
+		}
+		return a.verifyJWT(strings.TrimSpace(token))
+	}
+	return Principal{}, errMissingCredentials
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Role      string          `json:"role"`
+	Roles     []string        `json:"roles"`
+}
+
+func (a *Authenticator) verifyJWT(token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, errors.New("malformed JWT")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, fmt.Errorf("malformed JWT header: %w", err)
+	}
+	if header.Alg != "HS256" && header.Alg != "RS256" {
+		return Principal{}, fmt.Errorf("unsupported JWT alg %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, errors.New("malformed JWT signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if !a.verifySignature(header, signed, sig) {
+		return Principal{}, errors.New("invalid JWT signature")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+	if err := a.validateClaims(&claims); err != nil {
+		return Principal{}, err
+	}
+
+	p := Principal{Subject: claims.Subject}
+	for _, name := range append(claims.Roles, claims.Role) {
+		if role, ok := parseRole(name); ok && role > p.Role {
+			p.Role = role
+		}
+	}
+	return p, nil
+}
+
+func (a *Authenticator) verifySignature(header jwtHeader, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	for _, k := range a.jwtKeys {
+		if k.alg != header.Alg || (header.Kid != "" && k.kid != header.Kid) {
+			continue
+		}
+		switch k.alg {
+		case "HS256":
+			mac := hmac.New(sha256.New, k.secret)
+			mac.Write(signed)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return true
+			}
+		case "RS256":
+			if rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *Authenticator) validateClaims(c *jwtClaims) error {
+	now := time.Now()
+	if c.Subject == "" {
+		return errors.New("JWT has no sub claim")
+	}
+	if c.ExpiresAt == nil {
+		return errors.New("JWT has no exp claim")
+	}
+	if now.After(time.Unix(*c.ExpiresAt, 0).Add(a.leeway)) {
+		return errors.New("JWT has expired")
+	}
+	if c.NotBefore != nil && now.Add(a.leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return errors.New("JWT is not valid yet")
+	}
+	if a.issuer != "" && c.Issuer != a.issuer {
+		return errors.New("JWT issuer is not accepted")
+	}
+	if a.audience != "" && !audienceContains(c.Audience, a.audience) {
+		return errors.New("JWT audience is not accepted")
+	}
+	return nil
+}
+
+// audienceContains handles "aud" as either a string or an array of strings.
+func audienceContains(raw json.RawMessage, want string) bool {
+	var one string
+	if json.Unmarshal(raw, &one) == nil {
+		return one == want
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, aud := range many {
+			if aud == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// authMiddleware attaches the request's principal to its context. Requests
+// without credentials continue as anonymous so that each route can decide
+// what it needs via requireRole; invalid credentials are rejected with 401.
+func authMiddleware(auth *Authenticator, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var p Principal
+		if auth.disabled {
+			p = Principal{Subject: "anonymous", Role: RoleAdmin}
+		} else {
+			var err error
+			p, err = auth.Authenticate(r)
+			if err != nil && err != errMissingCredentials {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, http.StatusUnauthorized, "UNAUTHORIZED",
+					"Invalid credentials", err.Error())
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), principalKey{}, p)
+		ctx = context.WithValue(ctx, loggerKey{}, loggerFrom(ctx).With("subject", p.Subject))
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requireRole writes 401 or 403 and returns false unless the caller has at
+// least the given role.
+func requireRole(w http.ResponseWriter, r *http.Request, role Role) bool {
+	p := principalFrom(r.Context())
+	if p.Subject == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Authentication required",
+			"Provide an X-API-Key header or an Authorization: Bearer token")
+		return false
+	}
+	if p.Role < role {
+		writeError(w, http.StatusForbidden, "FORBIDDEN", "Insufficient permissions",
+			fmt.Sprintf("This operation requires the %s role", role))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ==================== CORS ====================
+
+// CORSPolicy decides which cross-origin browser requests are allowed.
+type CORSPolicy struct {
+	// AllowedOrigins holds exact origins ("https://shop.example.com"),
+	// wildcard patterns ("https://*.example.com") or "*" for any origin.
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int // seconds; 0 omits Access-Control-Max-Age
+}
+
+// loadCORSPolicy reads the policy from the environment. Lists are
+// comma-separated:
+//
+//	CORS_ALLOWED_ORIGINS   default "http://127.0.0.1:5500,http://localhost:5500"
+//	CORS_ALLOWED_HEADERS   default "Content-Type,Authorization,X-API-Key,Idempotency-Key"
+//	CORS_EXPOSED_HEADERS   default "X-Product-Version,Idempotent-Replayed"
+//	CORS_ALLOW_CREDENTIALS default false
+//	CORS_MAX_AGE           default 600
+//
+// Allowed methods are not configured: they come from the registered routes.
+// The origin "*" cannot be combined with credentials, which would let any
+// site make credentialed calls to the API.
+func loadCORSPolicy() (CORSPolicy, error) {
+	policy := CORSPolicy{
+		AllowedOrigins: envList("CORS_ALLOWED_ORIGINS", "http://127.0.0.1:5500,http://localhost:5500"),
+		AllowedHeaders: envList("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-API-Key,Idempotency-Key"),
+		ExposedHeaders: envList("CORS_EXPOSED_HEADERS", "X-Product-Version,Idempotent-Replayed"),
+		MaxAge:         600,
+	}
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return CORSPolicy{}, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS %q", v)
+		}
+		policy.AllowCredentials = b
+	}
+	if v := os.Getenv("CORS_MAX_AGE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return CORSPolicy{}, fmt.Errorf("invalid CORS_MAX_AGE %q", v)
+		}
+		policy.MaxAge = n
+	}
+	for _, o := range policy.AllowedOrigins {
+		if _, err := path.Match(o, ""); err != nil {
+			return CORSPolicy{}, fmt.Errorf("invalid origin pattern %q in CORS_ALLOWED_ORIGINS", o)
+		}
+	}
+	if policy.AllowCredentials && containsString(policy.AllowedOrigins, "*") {
+		return CORSPolicy{}, errors.New("CORS_ALLOWED_ORIGINS=* cannot be combined with CORS_ALLOW_CREDENTIALS=true; list the allowed origins")
+	}
+	return policy, nil
+}
+
+func envList(name, def string) []string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		v = def
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func (p *CORSPolicy) originAllowed(origin string) bool {
+	for _, pattern := range p.AllowedOrigins {
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if ok, _ := path.Match(pattern, origin); ok && strings.ContainsAny(pattern, "*?[") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CORSPolicy) headersAllowed(requested string) (string, bool) {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		allowed := false
+		for _, a := range p.AllowedHeaders {
+			if a == "*" || strings.EqualFold(a, h) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return h, false
+		}
+	}
+	return "", true
+}
+
+// corsMiddleware applies the policy. Preflight requests are answered here
+// and never reach the handler: they get 204 when the origin, method and
+// headers are allowed, and 403 otherwise.
+func corsMiddleware(policy CORSPolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		methods := append(allowedMethods(r.URL.Path), http.MethodOptions)
+
+		if r.Method == http.MethodOptions {
+			reqMethod := r.Header.Get("Access-Control-Request-Method")
+			if origin == "" || reqMethod == "" {
+				// Not a CORS preflight: just describe the resource.
+				w.Header().Set("Allow", strings.Join(methods, ", "))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+			switch {
+			case !policy.originAllowed(origin):
+				writeError(w, http.StatusForbidden, "CORS_REJECTED", "CORS preflight rejected",
+					fmt.Sprintf("Origin %s is not allowed", origin))
+			case !containsString(methods, reqMethod):
+				writeError(w, http.StatusForbidden, "CORS_REJECTED", "CORS preflight rejected",
+					fmt.Sprintf("Method %s is not allowed for %s", reqMethod, r.URL.Path))
+			default:
+				reqHeaders := r.Header.Get("Access-Control-Request-Headers")
+				if h, ok := policy.headersAllowed(reqHeaders); !ok {
+					writeError(w, http.StatusForbidden, "CORS_REJECTED", "CORS preflight rejected",
+						fmt.Sprintf("Header %s is not allowed", h))
+					return
+				}
+				policy.setOriginHeaders(w, origin)
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				if reqHeaders != "" {
+					w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+				}
+				if policy.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		if origin != "" && policy.originAllowed(origin) {
+			policy.setOriginHeaders(w, origin)
+			if len(policy.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+		}
+		next(w, r)
+	}
+}
+
+// setOriginHeaders echoes the request origin, or sends "*" for a wildcard
+// policy, which loadCORSPolicy only allows without credentials.
+func (p *CORSPolicy) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if containsString(p.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
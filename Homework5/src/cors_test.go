@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoadCORSPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     string
+		credentials string
+		wantErr     string
+	}{
+		{"defaults", "", "", ""},
+		{"wildcard", "*", "", ""},
+		{"origins with credentials", "https://shop.example.com,https://*.example.com", "true", ""},
+		{"wildcard with credentials", "https://shop.example.com,*", "true", "cannot be combined"},
+		{"wildcard without credentials", "*", "false", ""},
+		{"bad credentials", "", "maybe", "CORS_ALLOW_CREDENTIALS"},
+		{"bad pattern", "https://[", "", "origin pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.origins != "" {
+				t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+			}
+			t.Setenv("CORS_ALLOW_CREDENTIALS", tt.credentials)
+			_, err := loadCORSPolicy()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("loadCORSPolicy() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("loadCORSPolicy() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetOriginHeaders(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          CORSPolicy
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"wildcard", CORSPolicy{AllowedOrigins: []string{"*"}}, "*", ""},
+		{"listed", CORSPolicy{AllowedOrigins: []string{"https://a.example.com"}}, "https://a.example.com", ""},
+		{"credentials", CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}, "https://a.example.com", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.policy.setOriginHeaders(rec, "https://a.example.com")
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Idempotency Keys ====================
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	idempotencyMaxKeyLen = 255
+	idempotencyMaxBody   = 1 << 20
+)
+
+// storedResponse is the first response recorded for an idempotency key.
+// The header holds only what the handler set, not the request ID or CORS
+// headers the outer middleware set for that request; requestID is the
+// first request's, for replaying error bodies.
+type storedResponse struct {
+	status    int
+	header    http.Header
+	body      []byte
+	requestID string
+}
+
+// idempotencyEntry tracks one key. done is closed once the first request
+// holding the key has finished; resp is nil until then.
+type idempotencyEntry struct {
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	resp        *storedResponse
+	expires     time.Time
+}
+
+// IdempotencyStore remembers the first response per Idempotency-Key for ttl.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	ttl     time.Duration
+}
+
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	s := &IdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     ttl,
+	}
+	go s.sweep()
+	return s
+}
+
+// begin claims key for a request with the given fingerprint. If the key is
+// new, owner is true and the caller must call finish or abandon. Otherwise
+// the existing entry is returned so the caller can wait on it.
+func (s *IdempotencyStore) begin(key string, fp [sha256.Size]byte) (e *idempotencyEntry, owner bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && (e.resp == nil || time.Now().Before(e.expires)) {
+		return e, false
+	}
+	e = &idempotencyEntry{fingerprint: fp, done: make(chan struct{})}
+	s.entries[key] = e
+	return e, true
+}
+
+// finish stores the response for key and wakes any waiting duplicates.
+func (s *IdempotencyStore) finish(key string, e *idempotencyEntry, resp *storedResponse) {
+	s.mu.Lock()
+	e.resp = resp
+	e.expires = time.Now().Add(s.ttl)
+	s.mu.Unlock()
+	close(e.done)
+}
+
+// abandon releases key without storing a response, so a retry runs again.
+func (s *IdempotencyStore) abandon(key string, e *idempotencyEntry) {
+	s.mu.Lock()
+	if s.entries[key] == e {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+	close(e.done)
+}
+
+// sweep periodically drops expired entries so memory stays bounded by the TTL.
+func (s *IdempotencyStore) sweep() {
+	interval := s.ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	for range time.Tick(interval) {
+		now := time.Now()
+		s.mu.Lock()
+		for key, e := range s.entries {
+			if e.resp != nil && now.After(e.expires) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// loadIdempotencyTTL reads IDEMPOTENCY_TTL (a Go duration, default 24h).
+func loadIdempotencyTTL() time.Duration {
+	ttl := 24 * time.Hour
+	if v := os.Getenv("IDEMPOTENCY_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			fatal("Invalid IDEMPOTENCY_TTL", "value", v)
+		}
+		ttl = d
+	}
+	return ttl
+}
+
+// responseRecorder passes the response through to the client while keeping
+// a copy of the status, headers and body for replay.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotencyMiddleware makes POST requests that carry an Idempotency-Key
+// safe to retry: the first response is stored and replayed for exact
+// retries, a reused key with a different payload gets 422, and a duplicate
+// that arrives while the first is still running waits for its result.
+// 5xx, 401 and 403 responses are not stored so that the retry gets a fresh
+// attempt, after a server error or with fixed credentials or roles.
+func idempotencyMiddleware(store *IdempotencyStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if r.Method != http.MethodPost || key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > idempotencyMaxKeyLen {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid Idempotency-Key",
+				"Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		// Keys are scoped to the caller so one client cannot replay another's response.
+		key = principalFrom(r.Context()).Subject + "\x00" + key
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idempotencyMaxBody))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT",
+				"Could not read request body", err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fp := requestFingerprint(r, body)
+
+		for {
+			e, owner := store.begin(key, fp)
+			if owner {
+				runIdempotent(store, key, e, w, r, next)
+				return
+			}
+			if e.fingerprint != fp {
+				writeError(w, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED",
+					"Idempotency-Key was already used with a different request",
+					"Use a new Idempotency-Key for a different payload")
+				return
+			}
+
+			select {
+			case <-e.done:
+			case <-r.Context().Done():
+				return
+			}
+			if e.resp != nil {
+				replayResponse(w, e.resp)
+				return
+			}
+			// The first attempt was abandoned; try to claim the key again.
+		}
+	}
+}
+
+func runIdempotent(store *IdempotencyStore, key string, e *idempotencyEntry,
+	w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	rec := &responseRecorder{ResponseWriter: w}
+	before := w.Header().Clone()
+	defer func() {
+		if err := recover(); err != nil {
+			store.abandon(key, e)
+			panic(err)
+		}
+		switch {
+		case rec.status == 0, rec.status >= http.StatusInternalServerError,
+			rec.status == http.StatusUnauthorized, rec.status == http.StatusForbidden:
+			store.abandon(key, e)
+			return
+		}
+		store.finish(key, e, &storedResponse{
+			status:    rec.status,
+			header:    handlerHeader(before, w.Header()),
+			body:      rec.body.Bytes(),
+			requestID: w.Header().Get(requestIDHeader),
+		})
+	}()
+	next(rec, r)
+}
+
+// handlerHeader returns the headers of after that the handler set, that
+// is the ones that differ from before it ran. Vary, X-Request-ID and the
+// Access-Control-* headers are left out even so: they describe the
+// request, so a replay gets its own from the outer middleware.
+func handlerHeader(before, after http.Header) http.Header {
+	h := make(http.Header)
+	for k, v := range after {
+		if slices.Equal(before[k], v) || k == "Vary" || k == http.CanonicalHeaderKey(requestIDHeader) ||
+			strings.HasPrefix(k, "Access-Control-") {
+			continue
+		}
+		h[k] = slices.Clone(v)
+	}
+	return h
+}
+
+// replayResponse writes resp under the retry's own X-Request-ID, which
+// requestIDMiddleware has already set, including in an error body.
+func replayResponse(w http.ResponseWriter, resp *storedResponse) {
+	for k, v := range resp.header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.status)
+	w.Write(replayBody(resp, w.Header().Get(requestIDHeader)))
+}
+
+// replayBody returns the stored body, with the request_id of an error
+// written by writeError changed to requestID.
+func replayBody(resp *storedResponse, requestID string) []byte {
+	if resp.status < http.StatusBadRequest || resp.requestID == "" {
+		return resp.body
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(resp.body, &errResp); err != nil || errResp.RequestID != resp.requestID {
+		return resp.body
+	}
+	errResp.RequestID = requestID
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(errResp)
+	return buf.Bytes()
+}
+
+// requestFingerprint identifies "the same request" for idempotency purposes.
+func requestFingerprint(r *http.Request, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.Path)
+	h.Write([]byte{0})
+	h.Write(body)
+	var fp [sha256.Size]byte
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
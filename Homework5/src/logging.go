@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	mrand "math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== Logging ====================
+//
+// This file is kept in step with Homework6/src/logging.go, which also
+// logs /health checks at debug level: fix both. Each homework is its own
+// module, built by its Dockerfile and Terraform from its src directory
+// alone, so the two cannot import a shared package.
+
+const requestIDHeader = "X-Request-ID"
+
+type loggerKey struct{}
+
+// setupLogger installs a JSON slog handler as the default logger, which
+// also routes the standard log package through it. Settings:
+//
+//	LOG_LEVEL       debug | info | warn | error (default info)
+//	LOG_SAMPLE_RATE fraction of non-error access logs to keep (default 1)
+//
+// It returns the access log sample rate.
+func setupLogger() float64 {
+	level := slog.LevelInfo
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			fatal("Invalid LOG_LEVEL", "value", v)
+		}
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})))
+
+	rate := 1.0
+	if v := os.Getenv("LOG_SAMPLE_RATE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			fatal("Invalid LOG_SAMPLE_RATE", "value", v)
+		}
+		rate = f
+	}
+	return rate
+}
+
+// fatal logs at error level and exits, like log.Fatalf for slog.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// loggerFrom returns the request-scoped logger, which carries request_id.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// validRequestID accepts client-supplied IDs that are short and safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDMiddleware propagates the caller's X-Request-ID or generates a
+// new one, echoes it in the response and attaches a logger carrying it to
+// the request context. writeError reads it back from the response header.
+func requestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		next(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger)))
+	}
+}
+
+// statusWriter records the status code and body size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+// accessLogMiddleware writes one log line per request with its latency,
+// status and response size. 5xx responses are always logged; the rest are
+// kept with probability sampleRate.
+func accessLogMiddleware(sampleRate float64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		if sw.status < http.StatusInternalServerError && mrand.Float64() >= sampleRate {
+			return
+		}
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		loggerFrom(r.Context()).LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Int("bytes", sw.bytes),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+	}
+}
@@ -3,11 +3,14 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // ==================== Models ====================
@@ -21,36 +24,139 @@ type Product struct {
 	SomeOtherID  int    `json:"some_other_id"`
 }
 
+// ProductVersion is one retained revision of a product. Version numbers
+// start at 1 and increase by one on every successful POST .../details.
+type ProductVersion struct {
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ChangedBy string    `json:"changed_by"`
+	Product   Product   `json:"product"`
+}
+
+type HistoryResponse struct {
+	ProductID int              `json:"product_id"`
+	Versions  []ProductVersion `json:"versions"`
+}
+
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // ==================== In-Memory Store ====================
 
+// RetentionPolicy bounds how much history is kept per product. The latest
+// version is always kept, whatever the policy says.
+// Zero values disable the corresponding limit.
+type RetentionPolicy struct {
+	MaxVersions int
+	MaxAge      time.Duration
+}
+
+// ProductStore keeps every product as an ordered list of versions (oldest
+// first). The last element is the current value served by GET.
 type ProductStore struct {
-	mu       sync.RWMutex
-	products map[int]*Product
+	mu        sync.RWMutex
+	products  map[int][]ProductVersion
+	retention RetentionPolicy
 }
 
-func NewProductStore() *ProductStore {
+func NewProductStore(retention RetentionPolicy) *ProductStore {
 	return &ProductStore{
-		products: make(map[int]*Product),
+		products:  make(map[int][]ProductVersion),
+		retention: retention,
 	}
 }
 
 func (s *ProductStore) Get(id int) (*Product, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	p, ok := s.products[id]
-	return p, ok
+	versions, ok := s.products[id]
+	if !ok {
+		return nil, false
+	}
+	p := versions[len(versions)-1].Product
+	return &p, true
 }
 
-func (s *ProductStore) Set(id int, p *Product) {
+// Set appends p as a new version of product id and returns that version.
+func (s *ProductStore) Set(id int, p *Product, changedBy string) ProductVersion {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.products[id] = p
+
+	versions := s.products[id]
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Version + 1
+	}
+	v := ProductVersion{
+		Version:   next,
+		UpdatedAt: time.Now().UTC(),
+		ChangedBy: changedBy,
+		Product:   *p,
+	}
+	s.products[id] = s.prune(append(versions, v), v.UpdatedAt)
+	return v
+}
+
+// History returns a copy of the retained versions of product id, oldest first.
+func (s *ProductStore) History(id int) ([]ProductVersion, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions, ok := s.products[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]ProductVersion(nil), versions...), true
+}
+
+// GetVersion returns the retained version of product id with the given number.
+func (s *ProductStore) GetVersion(id, version int) (*ProductVersion, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.products[id] {
+		if v.Version == version {
+			return &v, true
+		}
+	}
+	return nil, false
+}
+
+// GetAsOf returns the version of product id that was current at time t,
+// i.e. the newest retained version written at or before t.
+func (s *ProductStore) GetAsOf(id int, t time.Time) (*ProductVersion, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := s.products[id]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].UpdatedAt.After(t) {
+			v := versions[i]
+			return &v, true
+		}
+	}
+	return nil, false
+}
+
+// prune drops the oldest versions that fall outside the retention policy.
+// Caller must hold s.mu.
+func (s *ProductStore) prune(versions []ProductVersion, now time.Time) []ProductVersion {
+	drop := 0
+	if max := s.retention.MaxVersions; max > 0 && len(versions) > max {
+		drop = len(versions) - max
+	}
+	if s.retention.MaxAge > 0 {
+		cutoff := now.Add(-s.retention.MaxAge)
+		for drop < len(versions)-1 && versions[drop].UpdatedAt.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return versions
+	}
+	// Copy so the dropped versions can be garbage collected.
+	return append([]ProductVersion(nil), versions[drop:]...)
 }
 
 // ==================== Middleware ====================
@@ -59,7 +165,8 @@ func recoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("PANIC recovered: %v", err)
+				loggerFrom(r.Context()).Error("PANIC recovered",
+					"error", fmt.Sprintf("%v", err), "stack", string(debug.Stack()))
 				writeError(w, http.StatusInternalServerError,
 					"INTERNAL_ERROR", "Internal server error",
 					fmt.Sprintf("%v", err))
@@ -69,73 +176,145 @@ func recoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		if origin == "http://127.0.0.1:5500" || origin == "http://localhost:5500" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		}
+// ==================== Router & Handlers ====================
 
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
+var (
+	store            *ProductStore
+	idempotencyStore *IdempotencyStore
+	authenticator    *Authenticator
+)
 
-		next(w, r)
+// loadRetentionPolicy reads HISTORY_MAX_VERSIONS (default 100) and
+// HISTORY_MAX_AGE (a Go duration such as "720h", default unlimited).
+func loadRetentionPolicy() RetentionPolicy {
+	policy := RetentionPolicy{MaxVersions: 100}
+	if v := os.Getenv("HISTORY_MAX_VERSIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fatal("Invalid HISTORY_MAX_VERSIONS", "value", v)
+		}
+		policy.MaxVersions = n
+	}
+	if v := os.Getenv("HISTORY_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			fatal("Invalid HISTORY_MAX_AGE", "value", v)
+		}
+		policy.MaxAge = d
 	}
+	return policy
 }
 
-// ==================== Router & Handlers ====================
-
-var store = NewProductStore()
-
 func main() {
+	// The logger is set up first so that configuration errors are logged as JSON too.
+	sampleRate := setupLogger()
+	store = NewProductStore(loadRetentionPolicy())
+	idempotencyStore = NewIdempotencyStore(loadIdempotencyTTL())
+	authenticator = loadAuthenticator()
+	corsPolicy, err := loadCORSPolicy()
+	if err != nil {
+		fatal("Invalid CORS configuration", "error", err)
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/products/", corsMiddleware(recoveryMiddleware(handleProducts)))
+	mux.HandleFunc("/products/", requestIDMiddleware(accessLogMiddleware(sampleRate,
+		corsMiddleware(corsPolicy, recoveryMiddleware(authMiddleware(authenticator,
+			idempotencyMiddleware(idempotencyStore, handleProducts)))))))
 
 	port := ":5173"
-	log.Printf("Product API server starting on %s", port)
-	log.Fatal(http.ListenAndServe(port, mux))
+	slog.Info("Product API server starting", "addr", port)
+	fatal("Server stopped", "error", http.ListenAndServe(port, mux))
 }
 
-func handleProducts(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("X-Debug-Panic") == "1" {
-		panic("debug panic")
-	}
+// route is one endpoint under /products/{productId}. action is the path
+// segment after the product ID ("" for the product itself).
+type route struct {
+	method  string
+	action  string
+	role    Role
+	handler func(w http.ResponseWriter, r *http.Request, productID int)
+}
+
+var routes = []route{
+	// GET /products/{productId}[?as_of=<timestamp|version>]
+	{http.MethodGet, "", RoleReader, handleGetProduct},
+	// GET /products/{productId}/history
+	{http.MethodGet, "history", RoleReader, handleGetProductHistory},
+	// POST /products/{productId}/details
+	{http.MethodPost, "details", RoleWriter, handleAddProductDetails},
+}
 
-	path := strings.TrimPrefix(r.URL.Path, "/products/")
+// pathError describes why a /products/ path could not be parsed.
+type pathError struct {
+	message string
+	details string
+}
+
+// parseProductPath splits /products/{productId}[/{action}] into its parts.
+func parseProductPath(urlPath string) (productID int, action string, perr *pathError) {
+	path := strings.TrimPrefix(urlPath, "/products/")
 	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
 
 	if len(parts) == 0 || parts[0] == "" {
-		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Product ID is required", "")
-		return
+		return 0, "", &pathError{"Product ID is required", ""}
 	}
-
 	productID, err := strconv.Atoi(parts[0])
 	if err != nil || productID < 1 {
-		writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid product ID",
-			"Product ID must be a positive integer")
-		return
+		return 0, "", &pathError{"Invalid product ID", "Product ID must be a positive integer"}
+	}
+	return productID, strings.Join(parts[1:], "/"), nil
+}
+
+// allowedMethods lists the methods registered for a request path, or nil
+// if no route matches it.
+func allowedMethods(urlPath string) []string {
+	_, action, perr := parseProductPath(urlPath)
+	if perr != nil {
+		return nil
+	}
+	var methods []string
+	for _, rt := range routes {
+		if rt.action == action {
+			methods = append(methods, rt.method)
+		}
 	}
+	return methods
+}
 
-	switch {
-	// GET /products/{productId}
-	case len(parts) == 1 && r.Method == http.MethodGet:
-		handleGetProduct(w, productID)
+func handleProducts(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Debug-Panic") == "1" {
+		panic("debug panic")
+	}
 
-	// POST /products/{productId}/details
-	case len(parts) == 2 && parts[1] == "details" && r.Method == http.MethodPost:
-		handleAddProductDetails(w, r, productID)
+	productID, action, perr := parseProductPath(r.URL.Path)
+	if perr != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_INPUT", perr.message, perr.details)
+		return
+	}
+
+	for _, rt := range routes {
+		if rt.action == action && rt.method == r.Method {
+			if !requireRole(w, r, rt.role) {
+				return
+			}
+			rt.handler(w, r, productID)
+			return
+		}
+	}
 
-	default:
-		writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
+	if methods := allowedMethods(r.URL.Path); len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
 	}
+	writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed", "")
 }
 
 // GET /products/{productId} → 200 / 404 / 500
-func handleGetProduct(w http.ResponseWriter, productID int) {
+func handleGetProduct(w http.ResponseWriter, r *http.Request, productID int) {
+	if asOf := r.URL.Query().Get("as_of"); asOf != "" {
+		handleGetProductAsOf(w, productID, asOf)
+		return
+	}
+
 	product, found := store.Get(productID)
 	if !found {
 		writeError(w, http.StatusNotFound, "NOT_FOUND", "Product not found",
@@ -172,10 +351,67 @@ func handleAddProductDetails(w http.ResponseWriter, r *http.Request, productID i
 	}
 
 	// 204: success
-	store.Set(productID, &product)
+	v := store.Set(productID, &product, changedBy(r))
+	w.Header().Set("X-Product-Version", strconv.Itoa(v.Version))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GET /products/{productId}/history → 200 / 404
+func handleGetProductHistory(w http.ResponseWriter, r *http.Request, productID int) {
+	versions, found := store.History(productID)
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Product not found",
+			fmt.Sprintf("No product found with ID %d", productID))
+		return
+	}
+	writeJSON(w, http.StatusOK, HistoryResponse{ProductID: productID, Versions: versions})
+}
+
+// GET /products/{productId}?as_of=... → 200 / 400 / 404
+// as_of is either a version number or an RFC 3339 timestamp.
+func handleGetProductAsOf(w http.ResponseWriter, productID int, asOf string) {
+	var (
+		v     *ProductVersion
+		found bool
+	)
+	if n, err := strconv.Atoi(asOf); err == nil {
+		if n < 1 {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid as_of",
+				"as_of version must be a positive integer")
+			return
+		}
+		v, found = store.GetVersion(productID, n)
+	} else {
+		t, err := time.Parse(time.RFC3339Nano, asOf)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid as_of",
+				"as_of must be a version number or an RFC 3339 timestamp")
+			return
+		}
+		v, found = store.GetAsOf(productID, t)
+	}
+
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Product version not found",
+			fmt.Sprintf("No retained version of product %d matches as_of=%s", productID, asOf))
+		return
+	}
+	w.Header().Set("X-Product-Version", strconv.Itoa(v.Version))
+	writeJSON(w, http.StatusOK, v.Product)
+}
+
+// changedBy identifies the client that made a write, for the audit trail:
+// the authenticated subject when there is one, otherwise the client address.
+func changedBy(r *http.Request) string {
+	if p := principalFrom(r.Context()); p.Subject != "" && p.Subject != "anonymous" {
+		return p.Subject
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	return r.RemoteAddr
+}
+
 // ==================== Validation ====================
 
 func validateProduct(p *Product) string {
@@ -214,6 +450,9 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// writeError includes the request ID that requestIDMiddleware already set
+// on the response, so clients can quote it when reporting a problem.
 func writeError(w http.ResponseWriter, status int, errCode, message, details string) {
-	writeJSON(w, status, ErrorResponse{Error: errCode, Message: message, Details: details})
+	writeJSON(w, status, ErrorResponse{Error: errCode, Message: message, Details: details,
+		RequestID: w.Header().Get(requestIDHeader)})
 }
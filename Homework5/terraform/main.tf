@@ -1,4 +1,4 @@
-# Wire together four focused modules: network, ecr, logging, ecs.
+# Wire together five focused modules: network, ecr, logging, auth, ecs.
 
 module "network" {
   source         = "./modules/network"
@@ -17,6 +17,15 @@ module "logging" {
   retention_in_days = var.log_retention_days
 }
 
+module "auth" {
+  source       = "./modules/auth"
+  service_name = var.service_name
+  api_keys     = var.auth_api_keys
+  jwks         = var.auth_jwks
+  jwt_issuer   = var.auth_jwt_issuer
+  jwt_audience = var.auth_jwt_audience
+}
+
 # Reuse an existing IAM role for ECS tasks
 data "aws_iam_role" "lab_role" {
   name = "LabRole"
@@ -34,6 +43,8 @@ module "ecs" {
   log_group_name     = module.logging.log_group_name
   ecs_count          = var.ecs_count
   region             = var.aws_region
+  environment        = module.auth.environment
+  secrets            = module.auth.secrets
 }
 
 
@@ -0,0 +1,17 @@
+# SSM SecureString parameters holding the server's credentials. ECS reads
+# them at task start through the execution role, which needs
+# ssm:GetParameters on them and kms:Decrypt on the aws/ssm key.
+
+resource "aws_ssm_parameter" "api_keys" {
+  count = nonsensitive(var.api_keys != "") ? 1 : 0
+  name  = "/${var.service_name}/auth/api-keys"
+  type  = "SecureString"
+  value = var.api_keys
+}
+
+resource "aws_ssm_parameter" "jwks" {
+  count = nonsensitive(var.jwks != "") ? 1 : 0
+  name  = "/${var.service_name}/auth/jwks"
+  type  = "SecureString"
+  value = var.jwks
+}
@@ -0,0 +1,19 @@
+output "secrets" {
+  description = "Environment variable name => ARN of the SSM parameter holding its value"
+  value = {
+    for name, param in {
+      AUTH_API_KEYS = aws_ssm_parameter.api_keys
+      AUTH_JWKS     = aws_ssm_parameter.jwks
+    } : name => param[0].arn if length(param) > 0
+  }
+}
+
+output "environment" {
+  description = "Non-secret auth settings for the container environment"
+  value = {
+    for name, value in {
+      AUTH_JWT_ISSUER   = var.jwt_issuer
+      AUTH_JWT_AUDIENCE = var.jwt_audience
+    } : name => value if value != ""
+  }
+}
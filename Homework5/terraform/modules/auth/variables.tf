@@ -0,0 +1,36 @@
+variable "service_name" {
+  type        = string
+  description = "Used to name the SSM parameters"
+}
+
+variable "api_keys" {
+  type        = string
+  default     = ""
+  sensitive   = true
+  description = "JSON array of {\"key\", \"subject\", \"role\"} API keys"
+}
+
+variable "jwks" {
+  type        = string
+  default     = ""
+  sensitive   = true
+  description = "JWKS with oct (HS256) and/or RSA (RS256) keys for verifying JWTs"
+
+  # The server refuses to start without credentials.
+  validation {
+    condition     = nonsensitive(var.api_keys != "" || var.jwks != "")
+    error_message = "Set api_keys and/or jwks; the server refuses to start without credentials."
+  }
+}
+
+variable "jwt_issuer" {
+  type        = string
+  default     = ""
+  description = "Required iss claim of JWTs, if any"
+}
+
+variable "jwt_audience" {
+  type        = string
+  default     = ""
+  description = "Required aud claim of JWTs, if any"
+}
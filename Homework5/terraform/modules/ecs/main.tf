@@ -23,6 +23,9 @@ resource "aws_ecs_task_definition" "this" {
       containerPort = var.container_port
     }]
 
+    environment = [for name, value in var.environment : { name = name, value = value }]
+    secrets     = [for name, arn in var.secrets : { name = name, valueFrom = arn }]
+
     logConfiguration = {
       logDriver = "awslogs"
       options = {
@@ -60,3 +60,15 @@ variable "memory" {
   default     = "512"
   description = "Memory (MiB)"
 }
+
+variable "environment" {
+  type        = map(string)
+  default     = {}
+  description = "Container environment variables"
+}
+
+variable "secrets" {
+  type        = map(string)
+  default     = {}
+  description = "Container environment variables read from SSM parameters or Secrets Manager, name => ARN"
+}
@@ -1,5 +1,8 @@
 # Specify where to find the AWS & Docker providers
 terraform {
+  # Variable validations that refer to other variables need 1.9.
+  required_version = ">= 1.9"
+
   required_providers {
     aws = {
       source  = "hashicorp/aws"
@@ -30,3 +30,27 @@ variable "log_retention_days" {
   type    = number
   default = 7
 }
+
+# Credentials for the server, which refuses to start without API keys or
+# a JWKS. Pass the JSON with TF_VAR_auth_api_keys="$(cat keys.json)".
+variable "auth_api_keys" {
+  type      = string
+  default   = ""
+  sensitive = true
+}
+
+variable "auth_jwks" {
+  type      = string
+  default   = ""
+  sensitive = true
+}
+
+variable "auth_jwt_issuer" {
+  type    = string
+  default = ""
+}
+
+variable "auth_jwt_audience" {
+  type    = string
+  default = ""
+}
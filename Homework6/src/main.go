@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
@@ -45,7 +45,7 @@ func generateProducts() {
 			Brand:       brand,
 		})
 	}
-	log.Println("Generated 100,000 products")
+	slog.Info("Generated products", "count", 100000)
 }
 
 // ==================== Handlers ====================
@@ -94,12 +94,14 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 // ==================== Main ====================
 
 func main() {
+	sampleRate := setupLogger()
 	generateProducts()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/products/search", handleSearch)
 	mux.HandleFunc("/health", handleHealth)
 
-	log.Println("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", mux))
-}
\ No newline at end of file
+	handler := requestIDMiddleware(accessLogMiddleware(sampleRate, mux.ServeHTTP))
+	slog.Info("Server starting", "addr", ":8080")
+	fatal("Server stopped", "error", http.ListenAndServe(":8080", handler))
+}
@@ -0,0 +1,283 @@
+package albumserver
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// album represents data about a record album. Artist is the name of the
+// artist identified by ArtistID; see AlbumRepository for how the two are
+// kept in sync.
+type album struct {
+	ID       string  `json:"id" xml:"id"`
+	Title    string  `json:"title" xml:"title"`
+	Artist   string  `json:"artist" xml:"artist"`
+	ArtistID string  `json:"artist_id" xml:"artist_id"`
+	Price    float64 `json:"price" xml:"price"`
+}
+
+// artist represents a recording artist that albums refer to.
+type artist struct {
+	ID   string `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+// albumPatch is the body of PATCH /albums/:id. Nil fields are left unchanged.
+type albumPatch struct {
+	Title    *string  `json:"title" xml:"title"`
+	Artist   *string  `json:"artist" xml:"artist"`
+	ArtistID *string  `json:"artist_id" xml:"artist_id"`
+	Price    *float64 `json:"price" xml:"price"`
+}
+
+// fieldError describes one invalid field in a request body.
+type fieldError struct {
+	Field   string `json:"field" xml:"field"`
+	Message string `json:"message" xml:"message"`
+}
+
+// seedAlbums is the record album data a new repository starts with. The
+// repository creates artist records from the artist names.
+var seedAlbums = []album{
+	{ID: "1", Title: "Blue Train", Artist: "John Coltrane", Price: 56.99},
+	{ID: "2", Title: "Jeru", Artist: "Gerry Mulligan", Price: 17.99},
+	{ID: "3", Title: "Sarah Vaughan and Clifford Brown", Artist: "Sarah Vaughan", Price: 39.99},
+}
+
+// errInvalidAlbum stops a patch that leaves the album invalid.
+var errInvalidAlbum = errors.New("invalid album")
+
+// albumHandlers holds the dependencies of the album endpoints.
+type albumHandlers struct {
+	repo          AlbumRepository
+	covers        BlobStore
+	maxCoverBytes int64
+}
+
+// getAlbums responds with the albums matching the query string.
+// X-Total-Count carries the number of matches before pagination, and a
+// Link header points at the next page when there is one.
+func (h *albumHandlers) getAlbums(c *gin.Context) {
+	q, errs := parseAlbumQuery(c.Request.URL.Query())
+	if len(errs) > 0 {
+		respond(c, http.StatusBadRequest, gin.H{"message": "invalid query", "errors": errs})
+		return
+	}
+
+	albums, err := h.repo.List()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respondAlbumPage(c, q, albums)
+}
+
+// respondAlbumPage applies q to albums and writes the page with the
+// X-Total-Count and Link headers described on getAlbums.
+func respondAlbumPage(c *gin.Context, q albumQuery, albums []album) {
+	page, total := q.apply(albums)
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if q.limit > 0 && q.offset+len(page) < total {
+		next := c.Request.URL.Query()
+		next.Set("offset", strconv.Itoa(q.offset+len(page)))
+		c.Header("Link", "<"+c.Request.URL.Path+"?"+next.Encode()+`>; rel="next"`)
+	}
+	respond(c, http.StatusOK, page)
+}
+
+// postAlbums adds an album from the request body (JSON, XML, MessagePack or CSV).
+// The ID is generated by the server unless the client supplies one.
+func (h *albumHandlers) postAlbums(c *gin.Context) {
+	var newAlbum album
+	if !bindAlbum(c, &newAlbum) {
+		return
+	}
+
+	added, err := h.repo.Add(newAlbum)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Location", "/albums/"+added.ID)
+	respond(c, http.StatusCreated, added)
+}
+
+// getAlbumByID locates the album whose ID value matches the id
+// parameter sent by the client, then returns that album as a response.
+func (h *albumHandlers) getAlbumByID(c *gin.Context) {
+	id := c.Param("id")
+
+	a, ok, err := h.repo.Get(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !ok {
+		respondError(c, ErrNotFound)
+		return
+	}
+	respond(c, http.StatusOK, a)
+}
+
+// putAlbum replaces the album with the given id. The body may omit the ID,
+// but if present it must match the path.
+func (h *albumHandlers) putAlbum(c *gin.Context) {
+	id := c.Param("id")
+
+	var a album
+	if !bindAlbum(c, &a) {
+		return
+	}
+	if a.ID != "" && a.ID != id {
+		respond(c, http.StatusBadRequest, gin.H{
+			"message": "invalid album",
+			"errors":  []fieldError{{Field: "id", Message: "must match the ID in the path"}},
+		})
+		return
+	}
+	a.ID = id
+
+	updated, err := h.repo.Update(a)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, updated)
+}
+
+// patchAlbum updates only the fields present in the request body.
+func (h *albumHandlers) patchAlbum(c *gin.Context) {
+	id := c.Param("id")
+
+	var patch albumPatch
+	if !bindRequestBody(c, &patch) {
+		return
+	}
+
+	// The patch is merged and validated inside the repository, so that
+	// it applies to the album as stored, not to a copy another request
+	// may replace in the meantime.
+	var errs []fieldError
+	updated, err := h.repo.Patch(id, func(a *album) error {
+		if patch.Title != nil {
+			a.Title = *patch.Title
+		}
+		if patch.Artist != nil {
+			a.Artist = *patch.Artist
+			// A new name is matched against the artists again, unless the
+			// patch names the artist by ID as well.
+			a.ArtistID = ""
+		}
+		if patch.ArtistID != nil {
+			a.ArtistID = *patch.ArtistID
+		}
+		if patch.Price != nil {
+			a.Price = *patch.Price
+		}
+		if errs = validateAlbum(*a); len(errs) > 0 {
+			return errInvalidAlbum
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidAlbum) {
+		respond(c, http.StatusBadRequest, gin.H{"message": "invalid album", "errors": errs})
+		return
+	} else if err != nil {
+		respondError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, updated)
+}
+
+// deleteAlbum removes the album with the given id and its cover.
+func (h *albumHandlers) deleteAlbum(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.repo.Delete(id); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := h.covers.Delete(coverKey(id)); err != nil && !errors.Is(err, ErrBlobNotFound) {
+		log.Printf("Error deleting cover of album %s: %v", id, err)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// bindRequestBody decodes the body by its Content-Type, writing 415 for
+// unsupported types or 400 for undecodable bodies and returning false.
+func bindRequestBody(c *gin.Context, obj any) bool {
+	err := bindBody(c, obj)
+	switch {
+	case errors.Is(err, errUnsupportedMediaType):
+		respond(c, http.StatusUnsupportedMediaType, gin.H{"message": "unsupported Content-Type " + c.GetHeader("Content-Type")})
+		return false
+	case err != nil:
+		respond(c, http.StatusBadRequest, gin.H{"message": "invalid request body", "error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// bindAlbum decodes and validates an album body, writing a 400 with
+// the reasons and returning false if it is not acceptable.
+func bindAlbum(c *gin.Context, a *album) bool {
+	if !bindRequestBody(c, a) {
+		return false
+	}
+	if errs := validateAlbum(*a); len(errs) > 0 {
+		respond(c, http.StatusBadRequest, gin.H{"message": "invalid album", "errors": errs})
+		return false
+	}
+	return true
+}
+
+// validateAlbum checks the fields clients are allowed to set.
+func validateAlbum(a album) []fieldError {
+	var errs []fieldError
+	if strings.TrimSpace(a.Title) == "" {
+		errs = append(errs, fieldError{Field: "title", Message: "must not be empty"})
+	}
+	if strings.TrimSpace(a.Artist) == "" && a.ArtistID == "" {
+		errs = append(errs, fieldError{Field: "artist", Message: "must not be empty unless artist_id is set"})
+	}
+	if a.Price < 0 {
+		errs = append(errs, fieldError{Field: "price", Message: "must not be negative"})
+	}
+	if strings.Contains(a.ID, "/") {
+		errs = append(errs, fieldError{Field: "id", Message: "must not contain '/'"})
+	}
+	return errs
+}
+
+// respondJSON writes compact JSON, or indented JSON when the client asks
+// for it with ?pretty=1. Handlers use respond, which negotiates the format.
+func respondJSON(c *gin.Context, status int, obj any) {
+	if c.Query("pretty") == "1" {
+		c.IndentedJSON(status, obj)
+		return
+	}
+	c.JSON(status, obj)
+}
+
+// respondError maps repository errors to HTTP responses.
+func respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		respond(c, http.StatusNotFound, gin.H{"message": "album not found"})
+	case errors.Is(err, ErrDuplicateID):
+		respond(c, http.StatusConflict, gin.H{"message": "album with this ID already exists"})
+	case errors.Is(err, ErrUnknownArtist):
+		respond(c, http.StatusBadRequest, gin.H{
+			"message": "invalid album",
+			"errors":  []fieldError{{Field: "artist_id", Message: "must refer to an existing artist"}},
+		})
+	default:
+		respond(c, http.StatusInternalServerError, gin.H{"message": err.Error()})
+	}
+}
@@ -0,0 +1,58 @@
+package albumserver
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getArtists responds with all artists in creation order.
+func (h *albumHandlers) getArtists(c *gin.Context) {
+	artists, err := h.repo.ListArtists()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, artists)
+}
+
+// getArtistByID responds with one artist.
+func (h *albumHandlers) getArtistByID(c *gin.Context) {
+	ar, ok, err := h.repo.GetArtist(c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "artist not found"})
+		return
+	}
+	respond(c, http.StatusOK, ar)
+}
+
+// getArtistAlbums responds with the artist's albums. It takes the same
+// query string as GET /albums.
+func (h *albumHandlers) getArtistAlbums(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok, err := h.repo.GetArtist(id); err != nil {
+		respondError(c, err)
+		return
+	} else if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "artist not found"})
+		return
+	}
+
+	q, errs := parseAlbumQuery(c.Request.URL.Query())
+	if len(errs) > 0 {
+		respond(c, http.StatusBadRequest, gin.H{"message": "invalid query", "errors": errs})
+		return
+	}
+	q.artistID = id
+
+	albums, err := h.repo.List()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respondAlbumPage(c, q, albums)
+}
@@ -0,0 +1,195 @@
+package albumserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBlobNotFound is returned by BlobStore.Open and Delete for unknown keys.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrBlobTooLarge is returned by BlobStore.Put when the content exceeds
+// the size limit passed to it.
+var ErrBlobTooLarge = errors.New("blob too large")
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	ETag        string    `json:"etag"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// BlobStore stores binary objects such as album covers by key.
+type BlobStore interface {
+	// Put stores up to maxBytes read from r under key, replacing any
+	// existing blob. Readers longer than maxBytes give ErrBlobTooLarge
+	// and leave the existing blob untouched.
+	Put(key string, r io.Reader, contentType string, maxBytes int64) (BlobInfo, error)
+	// Open returns the blob's content and metadata.
+	Open(key string) (io.ReadSeekCloser, BlobInfo, error)
+	// Delete removes the blob.
+	Delete(key string) error
+}
+
+// localBlobStore keeps each blob's content in a file named after its
+// SHA-256, next to a "<key>.json" metadata file that points at it.
+// Replacing a blob only renames the metadata file, which is atomic, so a
+// reader always sees content and metadata that belong together.
+type localBlobStore struct {
+	dir string
+	// mu serializes writers so that unused content files are cleaned up
+	// reliably; readers never take it.
+	mu sync.Mutex
+}
+
+// blobMeta is the on-disk metadata file.
+type blobMeta struct {
+	BlobInfo
+	File string `json:"file"`
+}
+
+// NewLocalBlobStore returns a BlobStore rooted at dir, creating it if needed.
+func NewLocalBlobStore(dir string) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &localBlobStore{dir: dir}, nil
+}
+
+// metaPath maps a key to a file name that cannot escape dir.
+func (s *localBlobStore) metaPath(key string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(key)
+	return filepath.Join(s.dir, name+".json")
+}
+
+func (s *localBlobStore) readMeta(key string) (blobMeta, error) {
+	data, err := os.ReadFile(s.metaPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return blobMeta{}, ErrBlobNotFound
+	} else if err != nil {
+		return blobMeta{}, err
+	}
+	var meta blobMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return blobMeta{}, err
+	}
+	return meta, nil
+}
+
+func (s *localBlobStore) Put(key string, r io.Reader, contentType string, maxBytes int64) (BlobInfo, error) {
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	if n > maxBytes {
+		return BlobInfo{}, ErrBlobTooLarge
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	meta := blobMeta{
+		BlobInfo: BlobInfo{
+			ContentType: contentType,
+			Size:        n,
+			ETag:        `"` + sum + `"`,
+			ModTime:     time.Now().UTC().Truncate(time.Second),
+		},
+		File: sum,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, meta.File)); err != nil {
+		return BlobInfo{}, err
+	}
+	old, oldErr := s.readMeta(key)
+	if err := s.writeMeta(key, meta); err != nil {
+		return BlobInfo{}, err
+	}
+	if oldErr == nil && old.File != meta.File {
+		s.removeIfUnused(old.File)
+	}
+	return meta.BlobInfo, nil
+}
+
+func (s *localBlobStore) writeMeta(key string, meta blobMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.metaPath(key))
+}
+
+// removeIfUnused deletes a content file unless another key still points
+// at it (two albums can share identical cover images).
+func (s *localBlobStore) removeIfUnused(file string) {
+	metas, _ := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	for _, path := range metas {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var meta blobMeta
+		if json.Unmarshal(data, &meta) == nil && meta.File == file {
+			return
+		}
+	}
+	os.Remove(filepath.Join(s.dir, file))
+}
+
+func (s *localBlobStore) Open(key string) (io.ReadSeekCloser, BlobInfo, error) {
+	meta, err := s.readMeta(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, meta.File))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, BlobInfo{}, ErrBlobNotFound
+	} else if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return f, meta.BlobInfo, nil
+}
+
+func (s *localBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, err := s.readMeta(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(s.metaPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.removeIfUnused(meta.File)
+	return nil
+}
@@ -0,0 +1,185 @@
+package albumserver
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-yaml"
+)
+
+// Config holds everything that can be configured about the album server.
+// LoadConfig fills it from flags, environment variables and an optional
+// YAML file; the yaml tags give the key names in that file.
+type Config struct {
+	// Addr is the listen address of the REST and GraphQL API.
+	Addr string `yaml:"addr"`
+	// GRPCAddr is the listen address of the gRPC AlbumService. Empty
+	// disables gRPC.
+	GRPCAddr string `yaml:"grpc_addr"`
+	// AlbumsFile keeps albums in a JSON file. Empty keeps them in memory.
+	AlbumsFile string `yaml:"albums_file"`
+	// SeedFile is a JSON file with the albums (and optionally artists) a
+	// new repository starts with. Empty uses the built-in seed albums.
+	SeedFile string `yaml:"seed_file"`
+	// GinMode is "debug", "release" or "test".
+	GinMode string `yaml:"gin_mode"`
+	// CoversDir is where album cover images are stored.
+	CoversDir string `yaml:"covers_dir"`
+	// CoverMaxBytes is the largest cover image accepted.
+	CoverMaxBytes int64 `yaml:"cover_max_bytes"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests and gRPC streams
+	// get to finish after SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// TLS serves both APIs over TLS when CertFile and KeyFile are set.
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig names a PEM certificate and key.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// DefaultConfig returns the settings used for anything not configured.
+func DefaultConfig() Config {
+	return Config{
+		Addr:              ":8080",
+		GRPCAddr:          ":9090",
+		GinMode:           gin.DebugMode,
+		CoversDir:         "covers",
+		CoverMaxBytes:     5 << 20,
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   10 * time.Second,
+	}
+}
+
+// configFlags binds the command-line flags to cfg. Each flag has an
+// environment variable of the same meaning.
+func configFlags(cfg *Config, configFile *string) (*flag.FlagSet, map[string]string) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.StringVar(configFile, "config", *configFile, "optional YAML `file` with settings; flags and environment variables override it")
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "REST and GraphQL listen `address`")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", cfg.GRPCAddr, "gRPC listen `address`; empty disables gRPC")
+	fs.StringVar(&cfg.AlbumsFile, "albums-file", cfg.AlbumsFile, "keep albums in this JSON `file` instead of memory")
+	fs.StringVar(&cfg.SeedFile, "seed-file", cfg.SeedFile, "JSON `file` with the albums a new repository starts with")
+	fs.StringVar(&cfg.GinMode, "gin-mode", cfg.GinMode, "Gin `mode`: debug, release or test")
+	fs.StringVar(&cfg.CoversDir, "covers-dir", cfg.CoversDir, "`directory` for album cover images")
+	fs.Int64Var(&cfg.CoverMaxBytes, "cover-max-bytes", cfg.CoverMaxBytes, "largest cover image accepted, in `bytes`")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "HTTP read timeout")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", cfg.ReadHeaderTimeout, "HTTP read header timeout")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "HTTP write timeout")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "HTTP keep-alive idle timeout")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "graceful shutdown timeout")
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert", cfg.TLS.CertFile, "PEM certificate `file`; enables TLS together with -tls-key")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key", cfg.TLS.KeyFile, "PEM private key `file`")
+
+	env := map[string]string{
+		"config":              "ALBUM_CONFIG",
+		"addr":                "ALBUM_ADDR",
+		"grpc-addr":           "ALBUM_GRPC_ADDR",
+		"albums-file":         "ALBUMS_FILE",
+		"seed-file":           "ALBUM_SEED_FILE",
+		"gin-mode":            "GIN_MODE",
+		"covers-dir":          "COVERS_DIR",
+		"cover-max-bytes":     "COVER_MAX_BYTES",
+		"read-timeout":        "ALBUM_READ_TIMEOUT",
+		"read-header-timeout": "ALBUM_READ_HEADER_TIMEOUT",
+		"write-timeout":       "ALBUM_WRITE_TIMEOUT",
+		"idle-timeout":        "ALBUM_IDLE_TIMEOUT",
+		"shutdown-timeout":    "ALBUM_SHUTDOWN_TIMEOUT",
+		"tls-cert":            "ALBUM_TLS_CERT",
+		"tls-key":             "ALBUM_TLS_KEY",
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), "\nEvery flag can also be set with an environment variable:")
+		fs.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(fs.Output(), "  -%s\t%s\n", f.Name, env[f.Name])
+		})
+	}
+	return fs, env
+}
+
+// LoadConfig builds the configuration from, in increasing precedence,
+// defaults, the YAML file named by -config or ALBUM_CONFIG, environment
+// variables and the command-line flags in args. -h gives flag.ErrHelp.
+func LoadConfig(defaults Config, args []string) (Config, error) {
+	// The first pass only finds the config file, which sits below
+	// everything else.
+	scratch := defaults
+	configFile := os.Getenv("ALBUM_CONFIG")
+	fs, _ := configFlags(&scratch, &configFile)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := defaults
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := yaml.UnmarshalWithOptions(data, &cfg, yaml.Strict()); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", configFile, err)
+		}
+	}
+
+	fs, env := configFlags(&cfg, &configFile)
+	fs.SetOutput(io.Discard)
+	for name, variable := range env {
+		if v, ok := os.LookupEnv(variable); ok {
+			if err := fs.Set(name, v); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %w", variable, err)
+			}
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.validate()
+}
+
+func (cfg Config) validate() error {
+	var errs []error
+	if cfg.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	switch cfg.GinMode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		errs = append(errs, fmt.Errorf("gin mode %q must be debug, release or test", cfg.GinMode))
+	}
+	if cfg.CoverMaxBytes <= 0 {
+		errs = append(errs, errors.New("cover max bytes must be positive"))
+	}
+	for name, d := range map[string]time.Duration{
+		"read timeout":        cfg.ReadTimeout,
+		"read header timeout": cfg.ReadHeaderTimeout,
+		"write timeout":       cfg.WriteTimeout,
+		"idle timeout":        cfg.IdleTimeout,
+		"shutdown timeout":    cfg.ShutdownTimeout,
+	} {
+		if d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", name))
+		}
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("TLS needs both a certificate and a key file"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package albumserver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// coverTypes are the sniffed content types accepted as album covers.
+var coverTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func coverKey(albumID string) string {
+	return "cover-" + albumID
+}
+
+// putCover stores the cover image for an album. The image is either the
+// "cover" field of a multipart/form-data body or the raw request body.
+// Its type is sniffed from the content, not taken from the client.
+func (h *albumHandlers) putCover(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok, err := h.repo.Get(id); err != nil {
+		respondError(c, err)
+		return
+	} else if !ok {
+		respondError(c, ErrNotFound)
+		return
+	}
+
+	// Allow for multipart framing on top of the image itself.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxCoverBytes+64<<10)
+
+	var body io.Reader = c.Request.Body
+	if mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type")); mediaType == "multipart/form-data" {
+		file, _, err := c.Request.FormFile("cover")
+		if errors.As(err, new(*http.MaxBytesError)) {
+			respondUploadError(c, err)
+			return
+		} else if err != nil {
+			respond(c, http.StatusBadRequest, gin.H{"message": "multipart body needs a \"cover\" file field", "error": err.Error()})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	br := bufio.NewReaderSize(body, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		respondUploadError(c, err)
+		return
+	}
+	if len(head) == 0 {
+		respond(c, http.StatusBadRequest, gin.H{"message": "cover image is empty"})
+		return
+	}
+	contentType := http.DetectContentType(head)
+	if !coverTypes[contentType] {
+		respond(c, http.StatusUnsupportedMediaType, gin.H{"message": "cover must be a JPEG, PNG, GIF or WebP image, got " + contentType})
+		return
+	}
+
+	info, err := h.covers.Put(coverKey(id), br, contentType, h.maxCoverBytes)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	c.Header("ETag", info.ETag)
+	respond(c, http.StatusOK, info)
+}
+
+func respondUploadError(c *gin.Context, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.Is(err, ErrBlobTooLarge) || errors.As(err, &maxErr) {
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": "cover image is too large"})
+		return
+	}
+	respondError(c, err)
+}
+
+// getCover serves the cover image. http.ServeContent handles Range,
+// If-Range, If-None-Match and If-Modified-Since using the stored ETag and
+// modification time.
+func (h *albumHandlers) getCover(c *gin.Context) {
+	f, info, err := h.covers.Open(coverKey(c.Param("id")))
+	if errors.Is(err, ErrBlobNotFound) {
+		respond(c, http.StatusNotFound, gin.H{"message": "cover not found"})
+		return
+	} else if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer f.Close()
+
+	c.Header("Content-Type", info.ContentType)
+	c.Header("ETag", info.ETag)
+	c.Header("Cache-Control", "public, max-age=0, must-revalidate")
+	http.ServeContent(c.Writer, c.Request, "", info.ModTime, f)
+}
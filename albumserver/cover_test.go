@@ -0,0 +1,90 @@
+package albumserver
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testCoverMaxBytes = 1 << 10
+
+// pngCover returns a PNG signature padded to size bytes, which is all
+// putCover looks at.
+func pngCover(size int) []byte {
+	b := make([]byte, size)
+	copy(b, "\x89PNG\r\n\x1a\n")
+	return b
+}
+
+// multipartCover returns a multipart/form-data body with img in its
+// "cover" field, and its content type.
+func multipartCover(t *testing.T, img []byte) (io.Reader, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("cover", "cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(img)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func TestPutCover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	covers, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := newRouter(newAlbumFeed(newMemoryRepository(catalog{Albums: seedAlbums})), covers, testCoverMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		multipart bool
+		size      int
+		want      int
+	}{
+		{"raw", false, testCoverMaxBytes, http.StatusOK},
+		{"multipart", true, testCoverMaxBytes, http.StatusOK},
+		// Over the cover limit, but within the body limit, which allows
+		// for multipart framing.
+		{"raw over the cover limit", false, testCoverMaxBytes + 1, http.StatusRequestEntityTooLarge},
+		{"multipart over the cover limit", true, testCoverMaxBytes + 1, http.StatusRequestEntityTooLarge},
+		// Over the body limit too, so reading the body fails.
+		{"raw over the body limit", false, 1 << 20, http.StatusRequestEntityTooLarge},
+		{"multipart over the body limit", true, 1 << 20, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = bytes.NewReader(pngCover(tt.size))
+			contentType := "application/octet-stream"
+			if tt.multipart {
+				body, contentType = multipartCover(t, pngCover(tt.size))
+			}
+			req := httptest.NewRequest(http.MethodPut, "/albums/1/cover", body)
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("PUT %d-byte cover: %d %s, want %d", tt.size, rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/albums/1/cover", nil))
+	if rec.Code != http.StatusOK || rec.Body.Len() != testCoverMaxBytes {
+		t.Errorf("GET cover: %d with %d bytes, want %d bytes", rec.Code, rec.Body.Len(), testCoverMaxBytes)
+	}
+}
@@ -0,0 +1,531 @@
+package albumserver
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Limits applied to every GraphQL operation before it runs. Album and
+// Artist refer to each other, so without them a short query could fan out
+// without bound.
+const (
+	maxGraphQLDepth      = 8
+	maxGraphQLComplexity = 50000
+	// defaultGraphQLPage is the page size of albums(first:) when first is
+	// omitted, and the estimated length of list fields without first.
+	defaultGraphQLPage = 100
+)
+
+// artistAlbums returns the albums that refer to the artist with id.
+func artistAlbums(repo AlbumRepository, id string) ([]album, error) {
+	albums, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+	var out []album
+	for _, a := range albums {
+		if a.ArtistID == id {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// albumCursor encodes an album's position in a result list. Cursors are
+// opaque to clients.
+func albumCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func parseAlbumCursor(cursor string) (int, error) {
+	data, err := base64.StdEncoding.DecodeString(cursor)
+	if err == nil {
+		if n, ok := strings.CutPrefix(string(data), "offset:"); ok {
+			if offset, err := strconv.Atoi(n); err == nil && offset >= 0 {
+				return offset, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+// albumConnection is the result of the albums query.
+type albumConnection struct {
+	albums     []album
+	offset     int
+	totalCount int
+}
+
+// newGraphQLSchema builds the schema served at /graphql:
+//
+//	type Query {
+//	  albums(filter: AlbumFilter, first: Int, after: String): AlbumConnection!
+//	  album(id: ID!): Album
+//	  artist(id: ID!): Artist
+//	  artists: [Artist!]!
+//	}
+//	type Mutation {
+//	  addAlbum(input: AlbumInput!): Album!
+//	}
+//
+// All resolvers go through repo, like the REST handlers.
+func newGraphQLSchema(repo AlbumRepository) (graphql.Schema, error) {
+	artistType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Artist",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"albumCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					albums, err := artistAlbums(repo, p.Source.(artist).ID)
+					return len(albums), err
+				},
+			},
+		},
+	})
+
+	albumType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Album",
+		Fields: graphql.Fields{
+			"id":     &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"title":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"artist": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"artistId": &graphql.Field{
+				Type: graphql.ID,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if id := p.Source.(album).ArtistID; id != "" {
+						return id, nil
+					}
+					return nil, nil
+				},
+			},
+			"price": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"artistDetails": &graphql.Field{
+				Type: artistType,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					ar, ok, err := repo.GetArtist(p.Source.(album).ArtistID)
+					if err != nil || !ok {
+						return nil, err
+					}
+					return ar, nil
+				},
+			},
+		},
+	})
+
+	// Artist.albums refers back to Album, so it is added once both exist.
+	artistType.AddFieldConfig("albums", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(albumType))),
+		Resolve: func(p graphql.ResolveParams) (any, error) {
+			return artistAlbums(repo, p.Source.(artist).ID)
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					conn := p.Source.(albumConnection)
+					return conn.offset+len(conn.albums) < conn.totalCount, nil
+				},
+			},
+			"endCursor": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					conn := p.Source.(albumConnection)
+					if len(conn.albums) == 0 {
+						return nil, nil
+					}
+					return albumCursor(conn.offset + len(conn.albums) - 1), nil
+				},
+			},
+		},
+	})
+
+	type albumEdge struct {
+		cursor string
+		node   album
+	}
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AlbumEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(albumEdge).cursor, nil
+				},
+			},
+			"node": &graphql.Field{
+				Type: graphql.NewNonNull(albumType),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(albumEdge).node, nil
+				},
+			},
+		},
+	})
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AlbumConnection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					conn := p.Source.(albumConnection)
+					edges := make([]albumEdge, len(conn.albums))
+					for i, a := range conn.albums {
+						edges[i] = albumEdge{cursor: albumCursor(conn.offset + i), node: a}
+					}
+					return edges, nil
+				},
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(pageInfoType),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source, nil
+				},
+			},
+			"totalCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(albumConnection).totalCount, nil
+				},
+			},
+		},
+	})
+
+	filterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "AlbumFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"artist":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"artistId":      &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"titleContains": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"minPrice":      &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"maxPrice":      &graphql.InputObjectFieldConfig{Type: graphql.Float},
+			"sort": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "id, title, artist or price, optionally prefixed with '-'",
+			},
+		},
+	})
+
+	inputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "AlbumInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"id":    &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"title": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"artist": &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "Artist name, matched against existing artists; required unless artistId is set",
+			},
+			"artistId": &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"price":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"albums": &graphql.Field{
+				Type: graphql.NewNonNull(connectionType),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: filterType},
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultGraphQLPage},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return resolveAlbums(repo, p.Args)
+				},
+			},
+			"album": &graphql.Field{
+				Type: albumType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					a, ok, err := repo.Get(p.Args["id"].(string))
+					if err != nil || !ok {
+						return nil, err
+					}
+					return a, nil
+				},
+			},
+			"artist": &graphql.Field{
+				Type: artistType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					ar, ok, err := repo.GetArtist(p.Args["id"].(string))
+					if err != nil || !ok {
+						return nil, err
+					}
+					return ar, nil
+				},
+			},
+			"artists": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(artistType))),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return repo.ListArtists()
+				},
+			},
+		},
+	})
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"addAlbum": &graphql.Field{
+				Type: graphql.NewNonNull(albumType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(inputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					input := p.Args["input"].(map[string]any)
+					a := album{
+						Title: input["title"].(string),
+						Price: input["price"].(float64),
+					}
+					a.ID, _ = input["id"].(string)
+					a.Artist, _ = input["artist"].(string)
+					a.ArtistID, _ = input["artistId"].(string)
+					if errs := validateAlbum(a); len(errs) > 0 {
+						return nil, fieldErrorsToError("invalid album", errs)
+					}
+					added, err := repo.Add(a)
+					if errors.Is(err, ErrUnknownArtist) {
+						return nil, fmt.Errorf("invalid album: artistId %q does not refer to an existing artist", a.ArtistID)
+					}
+					return added, err
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType, Mutation: mutationType})
+}
+
+// resolveAlbums runs the albums query through the same filtering, sorting
+// and validation as GET /albums.
+func resolveAlbums(repo AlbumRepository, args map[string]any) (albumConnection, error) {
+	values := url.Values{}
+	if filter, ok := args["filter"].(map[string]any); ok {
+		for arg, param := range map[string]string{"artist": "artist", "artistId": "artist_id", "titleContains": "title_contains", "sort": "sort"} {
+			if v, ok := filter[arg].(string); ok {
+				values.Set(param, v)
+			}
+		}
+		for arg, param := range map[string]string{"minPrice": "min_price", "maxPrice": "max_price"} {
+			if v, ok := filter[arg].(float64); ok {
+				values.Set(param, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+	first, _ := args["first"].(int)
+	values.Set("limit", strconv.Itoa(first))
+	offset := 0
+	if after, ok := args["after"].(string); ok {
+		n, err := parseAlbumCursor(after)
+		if err != nil {
+			return albumConnection{}, err
+		}
+		offset = n + 1
+	}
+	values.Set("offset", strconv.Itoa(offset))
+
+	q, errs := parseAlbumQuery(values)
+	if len(errs) > 0 {
+		return albumConnection{}, fieldErrorsToError("invalid query", errs)
+	}
+	albums, err := repo.List()
+	if err != nil {
+		return albumConnection{}, err
+	}
+	page, total := q.apply(albums)
+	return albumConnection{albums: page, offset: offset, totalCount: total}, nil
+}
+
+// fieldErrorsToError renders validation errors as one GraphQL error message.
+// Query parameter names are reported as the GraphQL argument names.
+func fieldErrorsToError(msg string, errs []fieldError) error {
+	names := strings.NewReplacer("limit", "first", "offset", "after", "artist_id", "artistId",
+		"title_contains", "titleContains", "min_price", "minPrice", "max_price", "maxPrice")
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		parts[i] = names.Replace(e.Field) + " " + e.Message
+	}
+	return errors.New(msg + ": " + strings.Join(parts, "; "))
+}
+
+// graphQLRequest is the body of POST /graphql, or the query string of GET.
+type graphQLRequest struct {
+	Query         string         `json:"query" form:"query"`
+	OperationName string         `json:"operationName" form:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphQLHandler serves queries over GET and POST. Requests that cannot be
+// run at all (syntax errors, unknown fields, limits exceeded) get a 400;
+// errors raised while resolving fields are reported next to the data.
+func graphQLHandler(repo AlbumRepository) (gin.HandlerFunc, error) {
+	schema, err := newGraphQLSchema(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *gin.Context) {
+		var req graphQLRequest
+		if c.Request.Method == http.MethodGet {
+			c.ShouldBindQuery(&req)
+		} else if err := c.ShouldBindJSON(&req); err != nil {
+			respondJSON(c, http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": "invalid request body: " + err.Error()}}})
+			return
+		}
+
+		doc, err := parser.Parse(parser.ParseParams{
+			Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+		})
+		if err != nil {
+			respondJSON(c, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+		if result := graphql.ValidateDocument(&schema, doc, nil); !result.IsValid {
+			respondJSON(c, http.StatusBadRequest, &graphql.Result{Errors: result.Errors})
+			return
+		}
+		op := findOperation(doc, req.OperationName)
+		if op == nil {
+			respondJSON(c, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(
+				fmt.Errorf("unknown operation %q", req.OperationName))})
+			return
+		}
+		// GET must not change state.
+		if op.Operation != ast.OperationTypeQuery && c.Request.Method == http.MethodGet {
+			c.Header("Allow", "POST")
+			respondJSON(c, http.StatusMethodNotAllowed, &graphql.Result{Errors: gqlerrors.FormatErrors(
+				errors.New("mutations must be sent with POST"))})
+			return
+		}
+		if err := checkGraphQLLimits(doc, op, req.Variables); err != nil {
+			respondJSON(c, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+			return
+		}
+
+		respondJSON(c, http.StatusOK, graphql.Execute(graphql.ExecuteParams{
+			Schema:        schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       c.Request.Context(),
+		}))
+	}, nil
+}
+
+// findOperation returns the operation that will run: the one named name,
+// or the only operation in doc when name is empty.
+func findOperation(doc *ast.Document, name string) *ast.OperationDefinition {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op
+		}
+	}
+	return found
+}
+
+// checkGraphQLLimits rejects operations nested deeper than maxGraphQLDepth
+// or with an estimated cost above maxGraphQLComplexity. Every field costs 1;
+// the cost of a list field's selections is multiplied by its first
+// argument, or by defaultGraphQLPage when it has none. Introspection
+// fields are not counted.
+func checkGraphQLLimits(doc *ast.Document, op *ast.OperationDefinition, variables map[string]any) error {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[f.Name.Value] = f
+		}
+	}
+	listFields := map[string]bool{"albums": true, "artists": true}
+
+	var walk func(set *ast.SelectionSet, depth int) (maxDepth, cost int)
+	walk = func(set *ast.SelectionSet, depth int) (maxDepth, cost int) {
+		maxDepth = depth
+		if set == nil {
+			return maxDepth, 0
+		}
+		for _, sel := range set.Selections {
+			var d, c int
+			switch sel := sel.(type) {
+			case *ast.Field:
+				if strings.HasPrefix(sel.Name.Value, "__") {
+					continue
+				}
+				d, c = walk(sel.SelectionSet, depth+1)
+				if listFields[sel.Name.Value] {
+					c *= listSize(sel, variables)
+				}
+				c++
+			case *ast.InlineFragment:
+				d, c = walk(sel.SelectionSet, depth)
+			case *ast.FragmentSpread:
+				// Validation has already rejected unknown and cyclic fragments.
+				d, c = walk(fragments[sel.Name.Value].SelectionSet, depth)
+			}
+			maxDepth = max(maxDepth, d)
+			cost += c
+		}
+		return maxDepth, cost
+	}
+
+	depth, cost := walk(op.SelectionSet, 0)
+	if depth > maxGraphQLDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", depth, maxGraphQLDepth)
+	}
+	if cost > maxGraphQLComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", cost, maxGraphQLComplexity)
+	}
+	return nil
+}
+
+// listSize is the number of items a list field is expected to return.
+func listSize(field *ast.Field, variables map[string]any) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && n >= 0 {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := variables[v.Name.Value].(float64); ok && n >= 0 {
+				return int(n)
+			}
+		}
+	}
+	return defaultGraphQLPage
+}
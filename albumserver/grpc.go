@@ -0,0 +1,139 @@
+package albumserver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// albumServer implements the AlbumService defined in album.proto on top of
+// the same repository as the Gin handlers.
+type albumServer struct {
+	UnimplementedAlbumServiceServer
+	repo *albumFeed
+}
+
+// newGRPCServer returns a gRPC server with the AlbumService registered.
+// Reflection is enabled so tools such as grpcurl work without the .proto.
+func newGRPCServer(repo *albumFeed, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	RegisterAlbumServiceServer(s, &albumServer{repo: repo})
+	reflection.Register(s)
+	return s
+}
+
+func toProto(a album) *Album {
+	return &Album{Id: a.ID, Title: a.Title, Artist: a.Artist, ArtistId: a.ArtistID, Price: a.Price}
+}
+
+func (s *albumServer) GetAlbum(ctx context.Context, req *GetAlbumRequest) (*Album, error) {
+	a, ok, err := s.repo.Get(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "album %q not found", req.GetId())
+	}
+	return toProto(a), nil
+}
+
+func (s *albumServer) ListAlbums(req *ListAlbumsRequest, stream grpc.ServerStreamingServer[Album]) error {
+	// Go through parseAlbumQuery so the rules match GET /albums exactly.
+	values := url.Values{}
+	set := func(name, v string) {
+		if v != "" {
+			values.Set(name, v)
+		}
+	}
+	set("artist", req.GetArtist())
+	set("artist_id", req.GetArtistId())
+	set("title_contains", req.GetTitleContains())
+	set("sort", req.GetSort())
+	if req.MinPrice != nil {
+		set("min_price", strconv.FormatFloat(req.GetMinPrice(), 'f', -1, 64))
+	}
+	if req.MaxPrice != nil {
+		set("max_price", strconv.FormatFloat(req.GetMaxPrice(), 'f', -1, 64))
+	}
+	if req.GetLimit() != 0 {
+		set("limit", strconv.Itoa(int(req.GetLimit())))
+	}
+	if req.GetOffset() != 0 {
+		set("offset", strconv.Itoa(int(req.GetOffset())))
+	}
+	q, errs := parseAlbumQuery(values)
+	if len(errs) > 0 {
+		return status.Error(codes.InvalidArgument, describeFieldErrors(errs))
+	}
+
+	albums, err := s.repo.List()
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	page, _ := q.apply(albums)
+	for _, a := range page {
+		if err := stream.Send(toProto(a)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *albumServer) CreateAlbum(ctx context.Context, req *CreateAlbumRequest) (*Album, error) {
+	if req.GetAlbum() == nil {
+		return nil, status.Error(codes.InvalidArgument, "album is required")
+	}
+	a := album{
+		ID:       req.GetAlbum().GetId(),
+		Title:    req.GetAlbum().GetTitle(),
+		Artist:   req.GetAlbum().GetArtist(),
+		ArtistID: req.GetAlbum().GetArtistId(),
+		Price:    req.GetAlbum().GetPrice(),
+	}
+	if errs := validateAlbum(a); len(errs) > 0 {
+		return nil, status.Error(codes.InvalidArgument, describeFieldErrors(errs))
+	}
+	added, err := s.repo.Add(a)
+	switch {
+	case errors.Is(err, ErrDuplicateID):
+		return nil, status.Errorf(codes.AlreadyExists, "album %q already exists", a.ID)
+	case errors.Is(err, ErrUnknownArtist):
+		return nil, status.Errorf(codes.InvalidArgument, "artist_id %q does not refer to an existing artist", a.ArtistID)
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toProto(added), nil
+}
+
+func (s *albumServer) WatchAlbums(req *WatchAlbumsRequest, stream grpc.ServerStreamingServer[Album]) error {
+	albums, cancel := s.repo.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case a, ok := <-albums:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell too far behind; reconnect and list to catch up")
+			}
+			if err := stream.Send(toProto(a)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func describeFieldErrors(errs []fieldError) string {
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		parts[i] = e.Field + " " + e.Message
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,200 @@
+package albumserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestGRPC serves newGRPCServer over an in-memory connection and
+// returns a client for it, with the REST router sharing the same feed.
+func newTestGRPC(t *testing.T) (AlbumServiceClient, *albumFeed, http.Handler) {
+	t.Helper()
+	feed := newAlbumFeed(newMemoryRepository(catalog{Albums: seedAlbums}))
+
+	lis := bufconn.Listen(1 << 20)
+	srv := newGRPCServer(feed)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	gin.SetMode(gin.TestMode)
+	covers, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := newRouter(feed, covers, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAlbumServiceClient(conn), feed, router
+}
+
+func TestGRPCGetAlbum(t *testing.T) {
+	client, _, _ := newTestGRPC(t)
+	ctx := t.Context()
+
+	a, err := client.GetAlbum(ctx, &GetAlbumRequest{Id: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetTitle() != "Blue Train" || a.GetArtist() != "John Coltrane" || a.GetArtistId() == "" {
+		t.Errorf("GetAlbum(1) = %v", a)
+	}
+
+	_, err = client.GetAlbum(ctx, &GetAlbumRequest{Id: "nope"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetAlbum(nope) error = %v, want NotFound", err)
+	}
+}
+
+func TestGRPCListAlbums(t *testing.T) {
+	client, _, _ := newTestGRPC(t)
+
+	tests := []struct {
+		name string
+		req  *ListAlbumsRequest
+		want []string // album IDs, in order
+	}{
+		{"all", &ListAlbumsRequest{}, []string{"1", "2", "3"}},
+		{"artist", &ListAlbumsRequest{Artist: "john coltrane"}, []string{"1"}},
+		{"price range", &ListAlbumsRequest{MinPrice: proto.Float64(20), MaxPrice: proto.Float64(50)}, []string{"3"}},
+		{"title", &ListAlbumsRequest{TitleContains: "train"}, []string{"1"}},
+		{"sorted and paged", &ListAlbumsRequest{Sort: "-price", Limit: 2}, []string{"1", "3"}},
+		{"offset", &ListAlbumsRequest{Sort: "price", Offset: 1}, []string{"3", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.ListAlbums(t.Context(), tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for {
+				a, err := stream.Recv()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, a.GetId())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListAlbums(%v) streamed %v, want %v", tt.req, got, tt.want)
+			}
+		})
+	}
+
+	stream, err := client.ListAlbums(t.Context(), &ListAlbumsRequest{Sort: "color"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListAlbums with a bad sort: error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestGRPCCreateAlbum(t *testing.T) {
+	client, _, _ := newTestGRPC(t)
+	ctx := t.Context()
+
+	a, err := client.CreateAlbum(ctx, &CreateAlbumRequest{Album: &Album{Title: "Kind of Blue", Artist: "Miles Davis", Price: 29.99}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetId() == "" || a.GetArtistId() == "" {
+		t.Errorf("CreateAlbum returned %v, want generated IDs", a)
+	}
+	if got, err := client.GetAlbum(ctx, &GetAlbumRequest{Id: a.GetId()}); err != nil || !proto.Equal(got, a) {
+		t.Errorf("GetAlbum(%s) = %v, %v; want %v", a.GetId(), got, err, a)
+	}
+
+	tests := []struct {
+		name  string
+		album *Album
+		want  codes.Code
+	}{
+		{"duplicate ID", &Album{Id: "1", Title: "Again", Artist: "Someone"}, codes.AlreadyExists},
+		{"no album", nil, codes.InvalidArgument},
+		{"no title", &Album{Artist: "Someone"}, codes.InvalidArgument},
+		{"negative price", &Album{Title: "T", Artist: "Someone", Price: -1}, codes.InvalidArgument},
+		{"unknown artist ID", &Album{Title: "T", ArtistId: "999"}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.CreateAlbum(ctx, &CreateAlbumRequest{Album: tt.album})
+			if status.Code(err) != tt.want {
+				t.Errorf("CreateAlbum(%v) error = %v, want %v", tt.album, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCWatchAlbumsSeesREST(t *testing.T) {
+	client, feed, router := newTestGRPC(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchAlbums(ctx, &WatchAlbumsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stream is open before the server handler subscribes, so wait
+	// for the subscription before adding the album.
+	for {
+		feed.mu.Lock()
+		n := len(feed.subs)
+		feed.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("WatchAlbums never subscribed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/albums", strings.NewReader(`{"title":"Giant Steps","artist":"John Coltrane","price":24.99}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /albums: %d %s", rec.Code, rec.Body)
+	}
+
+	a, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.GetTitle() != "Giant Steps" || a.GetArtist() != "John Coltrane" || a.GetId() == "" {
+		t.Errorf("WatchAlbums received %v", a)
+	}
+	if rec.Header().Get("Location") != "/albums/"+a.GetId() {
+		t.Errorf("watched album %s, but REST created %s", a.GetId(), rec.Header().Get("Location"))
+	}
+}
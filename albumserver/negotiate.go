@@ -0,0 +1,246 @@
+package albumserver
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// Formats the album API can produce and consume.
+const (
+	formatJSON    = "json"
+	formatXML     = "xml"
+	formatCSV     = "csv"
+	formatMsgPack = "msgpack"
+)
+
+// formatMediaTypes maps each format to the media types that select it,
+// in the order they are tried during negotiation.
+var formatMediaTypes = []struct {
+	format string
+	types  []string
+}{
+	{formatJSON, []string{"application/json"}},
+	{formatXML, []string{"application/xml", "text/xml"}},
+	{formatCSV, []string{"text/csv"}},
+	{formatMsgPack, []string{"application/msgpack", "application/x-msgpack"}},
+}
+
+const formatKey = "responseFormat"
+
+// albumList gives a list of albums a root element when rendered as XML.
+type albumList struct {
+	XMLName xml.Name `xml:"albums"`
+	Albums  []album  `xml:"album"`
+}
+
+// artistList does the same for artists.
+type artistList struct {
+	XMLName xml.Name `xml:"artists"`
+	Artists []artist `xml:"artist"`
+}
+
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// acceptRange is one entry of an Accept header.
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept returns the ranges in an Accept header, best first.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		typ, subtype, _ := strings.Cut(mediaType, "/")
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		ranges = append(ranges, acceptRange{typ: typ, subtype: subtype, q: q})
+	}
+	// Higher q first; on ties, more specific ranges first, then header order.
+	specificity := func(r acceptRange) int {
+		switch {
+		case r.typ == "*":
+			return 0
+		case r.subtype == "*":
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return specificity(ranges[i]) > specificity(ranges[j])
+	})
+	return ranges
+}
+
+// negotiateFormat picks the response format for an Accept header, or ""
+// if none of the supported types is acceptable. No Accept header means JSON.
+func negotiateFormat(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return formatJSON
+	}
+	for _, r := range parseAccept(accept) {
+		if r.q <= 0 {
+			continue
+		}
+		for _, f := range formatMediaTypes {
+			for _, t := range f.types {
+				typ, subtype, _ := strings.Cut(t, "/")
+				if (r.typ == "*" || r.typ == typ) && (r.subtype == "*" || r.subtype == subtype) {
+					return f.format
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// negotiate chooses the response format from the Accept header and stores
+// it for respond, or aborts with 406 Not Acceptable.
+func negotiate(c *gin.Context) {
+	format := negotiateFormat(c.GetHeader("Accept"))
+	if format == "" {
+		var supported []string
+		for _, f := range formatMediaTypes {
+			supported = append(supported, f.types...)
+		}
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{
+			"message":   "none of the requested media types is supported",
+			"supported": supported,
+		})
+		return
+	}
+	c.Set(formatKey, format)
+	c.Next()
+}
+
+// respond writes obj in the negotiated format. CSV only applies to albums;
+// other payloads such as error messages fall back to JSON.
+func respond(c *gin.Context, status int, obj any) {
+	switch c.GetString(formatKey) {
+	case formatXML:
+		switch v := obj.(type) {
+		case []album:
+			obj = albumList{Albums: v}
+		case []artist:
+			obj = artistList{Artists: v}
+		}
+		c.XML(status, obj)
+	case formatMsgPack:
+		c.Render(status, render.MsgPack{Data: obj})
+	case formatCSV:
+		switch v := obj.(type) {
+		case []album:
+			writeAlbumsCSV(c, status, v)
+		case album:
+			writeAlbumsCSV(c, status, []album{v})
+		default:
+			respondJSON(c, status, obj)
+		}
+	default:
+		respondJSON(c, status, obj)
+	}
+}
+
+var csvHeader = []string{"id", "title", "artist", "price", "artist_id"}
+
+func writeAlbumsCSV(c *gin.Context, status int, albums []album) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(status)
+	w := csv.NewWriter(c.Writer)
+	w.Write(csvHeader)
+	for _, a := range albums {
+		w.Write([]string{a.ID, a.Title, a.Artist, strconv.FormatFloat(a.Price, 'f', -1, 64), a.ArtistID})
+	}
+	w.Flush()
+}
+
+// readAlbumCSV decodes a CSV body with a header row and one album row.
+// Columns are matched by name, so their order does not matter.
+func readAlbumCSV(body io.Reader) (album, error) {
+	records, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return album{}, err
+	}
+	if len(records) != 2 {
+		return album{}, errors.New("CSV body must have a header row and exactly one album row")
+	}
+	var a album
+	for i, name := range records[0] {
+		value := records[1][i]
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "id":
+			a.ID = value
+		case "title":
+			a.Title = value
+		case "artist":
+			a.Artist = value
+		case "artist_id":
+			a.ArtistID = value
+		case "price":
+			if a.Price, err = strconv.ParseFloat(value, 64); err != nil {
+				return album{}, fmt.Errorf("price: %w", err)
+			}
+		default:
+			return album{}, fmt.Errorf("unknown CSV column %q", name)
+		}
+	}
+	return a, nil
+}
+
+// bindBody decodes the request body according to its Content-Type. A
+// missing Content-Type is treated as JSON. It returns
+// errUnsupportedMediaType for types the API does not accept.
+func bindBody(c *gin.Context, obj any) error {
+	contentType := c.GetHeader("Content-Type")
+	if contentType == "" {
+		return c.ShouldBindWith(obj, binding.JSON)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return errUnsupportedMediaType
+	}
+
+	switch mediaType {
+	case "application/json":
+		return c.ShouldBindWith(obj, binding.JSON)
+	case "application/xml", "text/xml":
+		return c.ShouldBindWith(obj, binding.XML)
+	case "application/msgpack", "application/x-msgpack":
+		return c.ShouldBindWith(obj, binding.MsgPack)
+	case "text/csv":
+		a, ok := obj.(*album)
+		if !ok {
+			return errUnsupportedMediaType
+		}
+		decoded, err := readAlbumCSV(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		*a = decoded
+		return nil
+	}
+	return errUnsupportedMediaType
+}
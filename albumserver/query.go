@@ -0,0 +1,161 @@
+package albumserver
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxPageLimit = 1000
+
+// albumQuery holds the parsed query string of GET /albums.
+type albumQuery struct {
+	artist        string
+	artistID      string
+	titleContains string
+	minPrice      *float64
+	maxPrice      *float64
+	sortField     string // "" keeps insertion order
+	sortDesc      bool
+	limit         int // 0 means no limit
+	offset        int
+}
+
+// parseAlbumQuery reads
+//
+//	?artist=&artist_id=&title_contains=&min_price=&max_price=&sort=[-]field&limit=&offset=
+//
+// where field is one of id, title, artist or price.
+func parseAlbumQuery(values url.Values) (albumQuery, []fieldError) {
+	var (
+		q    albumQuery
+		errs []fieldError
+	)
+	q.artist = values.Get("artist")
+	q.artistID = values.Get("artist_id")
+	q.titleContains = strings.ToLower(values.Get("title_contains"))
+
+	parsePrice := func(name string) *float64 {
+		v := values.Get(name)
+		if v == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			errs = append(errs, fieldError{Field: name, Message: "must be a non-negative number"})
+			return nil
+		}
+		return &f
+	}
+	q.minPrice = parsePrice("min_price")
+	q.maxPrice = parsePrice("max_price")
+	if q.minPrice != nil && q.maxPrice != nil && *q.minPrice > *q.maxPrice {
+		errs = append(errs, fieldError{Field: "min_price", Message: "must not exceed max_price"})
+	}
+
+	if s := values.Get("sort"); s != "" {
+		q.sortDesc = strings.HasPrefix(s, "-")
+		q.sortField = strings.TrimPrefix(s, "-")
+		switch q.sortField {
+		case "id", "title", "artist", "price":
+		default:
+			errs = append(errs, fieldError{Field: "sort", Message: "must be id, title, artist or price, optionally prefixed with '-'"})
+		}
+	}
+
+	parseInt := func(name string, min, max int) int {
+		v := values.Get(name)
+		if v == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			errs = append(errs, fieldError{Field: name,
+				Message: "must be an integer between " + strconv.Itoa(min) + " and " + strconv.Itoa(max)})
+			return 0
+		}
+		return n
+	}
+	q.limit = parseInt("limit", 1, maxPageLimit)
+	q.offset = parseInt("offset", 0, int(^uint(0)>>1))
+
+	return q, errs
+}
+
+func (q albumQuery) matches(a album) bool {
+	if q.artist != "" && !strings.EqualFold(a.Artist, q.artist) {
+		return false
+	}
+	if q.artistID != "" && a.ArtistID != q.artistID {
+		return false
+	}
+	if q.titleContains != "" && !strings.Contains(strings.ToLower(a.Title), q.titleContains) {
+		return false
+	}
+	if q.minPrice != nil && a.Price < *q.minPrice {
+		return false
+	}
+	if q.maxPrice != nil && a.Price > *q.maxPrice {
+		return false
+	}
+	return true
+}
+
+// apply filters, sorts and paginates albums. It returns the requested page
+// and the number of albums that matched before pagination.
+func (q albumQuery) apply(albums []album) (page []album, total int) {
+	matched := make([]album, 0, len(albums))
+	for _, a := range albums {
+		if q.matches(a) {
+			matched = append(matched, a)
+		}
+	}
+
+	if q.sortField != "" {
+		less := func(a, b album) bool {
+			switch q.sortField {
+			case "id":
+				return lessID(a.ID, b.ID)
+			case "title":
+				return a.Title < b.Title
+			case "artist":
+				return a.Artist < b.Artist
+			default:
+				return a.Price < b.Price
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if q.sortDesc {
+				return less(matched[j], matched[i])
+			}
+			return less(matched[i], matched[j])
+		})
+	}
+
+	total = len(matched)
+	if q.offset >= total {
+		return []album{}, total
+	}
+	end := total
+	if q.limit > 0 && q.offset+q.limit < total {
+		end = q.offset + q.limit
+	}
+	return matched[q.offset:end], total
+}
+
+// lessID orders numeric IDs numerically and everything else as strings,
+// so "10" sorts after "9".
+func lessID(a, b string) bool {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return na < nb
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	}
+	return a < b
+}
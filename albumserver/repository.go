@@ -0,0 +1,511 @@
+package albumserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrDuplicateID is returned by Add when an album with the ID exists.
+	ErrDuplicateID = errors.New("album ID already exists")
+	// ErrNotFound is returned by Update, Patch and Delete for unknown IDs.
+	ErrNotFound = errors.New("album not found")
+	// ErrUnknownArtist is returned by Add, Update and Patch when an album's
+	// ArtistID does not refer to an existing artist.
+	ErrUnknownArtist = errors.New("unknown artist")
+)
+
+// AlbumRepository stores albums and the artists they refer to.
+// Implementations must be safe for concurrent use by the Gin handlers.
+//
+// Add and Update resolve each album's artist: a non-empty ArtistID must
+// name an existing artist, otherwise Artist is matched against existing
+// artist names ignoring case and spacing, and a new artist is created if
+// none matches. Either way the stored album carries the artist's ID and
+// canonical name.
+type AlbumRepository interface {
+	// List returns all albums in insertion order.
+	List() ([]album, error)
+	// Get returns the album with the given ID, or ok == false.
+	Get(id string) (a album, ok bool, err error)
+	// Add appends an album and returns it as stored. An empty ID is
+	// replaced with the next free numeric ID; a taken ID gives ErrDuplicateID.
+	Add(a album) (album, error)
+	// Update replaces the album with a.ID and returns it as stored, or
+	// returns ErrNotFound.
+	Update(a album) (album, error)
+	// Patch calls fn on the album with the given ID and stores the result
+	// like Update, holding off other writes in between so that concurrent
+	// patches do not overwrite each other. It returns ErrNotFound, or
+	// fn's error without storing anything. fn must not change the ID.
+	Patch(id string, fn func(a *album) error) (album, error)
+	// Delete removes the album with the given ID, or returns ErrNotFound.
+	// The artist record stays.
+	Delete(id string) error
+	// ListArtists returns all artists in creation order.
+	ListArtists() ([]artist, error)
+	// GetArtist returns the artist with the given ID, or ok == false.
+	GetArtist(id string) (a artist, ok bool, err error)
+}
+
+// catalog is the full contents of a repository, as persisted by
+// fileRepository.
+type catalog struct {
+	Artists []artist `json:"artists"`
+	Albums  []album  `json:"albums"`
+}
+
+// memoryRepository keeps albums in a slice guarded by a RWMutex, so the
+// 3:1 GET:POST Locust mix can read concurrently while writes serialize.
+// The slice preserves insertion order for List; index maps each ID to its
+// position in the slice so Get, Update and duplicate checks are O(1).
+// Artists are kept the same way.
+type memoryRepository struct {
+	mu     sync.RWMutex
+	albums []album
+	index  map[string]int
+	// nextID is the next candidate for a server-generated ID.
+	nextID int
+
+	artists     []artist
+	artistIndex map[string]int
+	// artistByName maps artistKey(name) to the artist's ID.
+	artistByName map[string]string
+	nextArtistID int
+}
+
+// newMemoryRepository returns an in-memory repository holding a copy of c.
+// Albums in c without artist records get them, as described on reset.
+func newMemoryRepository(c catalog) *memoryRepository {
+	r := &memoryRepository{nextID: 1, nextArtistID: 1}
+	r.reset(c)
+	return r
+}
+
+func (r *memoryRepository) List() ([]album, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	// Copy so callers never share the backing array with later appends.
+	return append([]album(nil), r.albums...), nil
+}
+
+func (r *memoryRepository) Get(id string) (album, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i := r.indexOf(id); i >= 0 {
+		return r.albums[i], true, nil
+	}
+	return album{}, false, nil
+}
+
+func (r *memoryRepository) Add(a album) (album, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if a.ID != "" && r.indexOf(a.ID) >= 0 {
+		return album{}, ErrDuplicateID
+	}
+	if err := r.resolveArtist(&a); err != nil {
+		return album{}, err
+	}
+	if a.ID == "" {
+		// Skip numbers a client has already claimed explicitly.
+		for r.indexOf(strconv.Itoa(r.nextID)) >= 0 {
+			r.nextID++
+		}
+		a.ID = strconv.Itoa(r.nextID)
+		r.nextID++
+	}
+	r.index[a.ID] = len(r.albums)
+	r.albums = append(r.albums, a)
+	return a, nil
+}
+
+func (r *memoryRepository) Update(a album) (album, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.indexOf(a.ID)
+	if i < 0 {
+		return album{}, ErrNotFound
+	}
+	if err := r.resolveArtist(&a); err != nil {
+		return album{}, err
+	}
+	r.albums[i] = a
+	return a, nil
+}
+
+func (r *memoryRepository) Patch(id string, fn func(a *album) error) (album, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.indexOf(id)
+	if i < 0 {
+		return album{}, ErrNotFound
+	}
+	a := r.albums[i]
+	if err := fn(&a); err != nil {
+		return album{}, err
+	}
+	a.ID = id
+	if err := r.resolveArtist(&a); err != nil {
+		return album{}, err
+	}
+	r.albums[i] = a
+	return a, nil
+}
+
+func (r *memoryRepository) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.indexOf(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.albums = append(r.albums[:i:i], r.albums[i+1:]...)
+	delete(r.index, id)
+	// Albums after i moved down by one.
+	for j := i; j < len(r.albums); j++ {
+		r.index[r.albums[j].ID] = j
+	}
+	return nil
+}
+
+func (r *memoryRepository) ListArtists() ([]artist, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]artist(nil), r.artists...), nil
+}
+
+func (r *memoryRepository) GetArtist(id string) (artist, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i, ok := r.artistIndex[id]; ok {
+		return r.artists[i], true, nil
+	}
+	return artist{}, false, nil
+}
+
+// indexOf returns the position of the album with id, or -1.
+// Caller must hold r.mu.
+func (r *memoryRepository) indexOf(id string) int {
+	if i, ok := r.index[id]; ok {
+		return i
+	}
+	return -1
+}
+
+// artistKey normalizes an artist name for matching, so "John Coltrane"
+// and " john  coltrane" are the same artist.
+func artistKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// resolveArtist sets a.ArtistID and a.Artist as described on
+// AlbumRepository. Albums without an artist name or ID are left alone.
+// Caller must hold r.mu.
+func (r *memoryRepository) resolveArtist(a *album) error {
+	if a.ArtistID != "" {
+		i, ok := r.artistIndex[a.ArtistID]
+		if !ok {
+			return ErrUnknownArtist
+		}
+		a.Artist = r.artists[i].Name
+		return nil
+	}
+	key := artistKey(a.Artist)
+	if key == "" {
+		return nil
+	}
+	if id, ok := r.artistByName[key]; ok {
+		a.ArtistID = id
+		a.Artist = r.artists[r.artistIndex[id]].Name
+		return nil
+	}
+	// Skip numbers already used by artists with explicit IDs.
+	for {
+		if _, taken := r.artistIndex[strconv.Itoa(r.nextArtistID)]; !taken {
+			break
+		}
+		r.nextArtistID++
+	}
+	ar := artist{ID: strconv.Itoa(r.nextArtistID), Name: strings.Join(strings.Fields(a.Artist), " ")}
+	r.addArtist(ar)
+	a.ArtistID, a.Artist = ar.ID, ar.Name
+	return nil
+}
+
+// addArtist appends ar to the artist list and indexes. Caller must hold r.mu.
+func (r *memoryRepository) addArtist(ar artist) {
+	r.artistIndex[ar.ID] = len(r.artists)
+	r.artists = append(r.artists, ar)
+	if key := artistKey(ar.Name); key != "" {
+		if _, ok := r.artistByName[key]; !ok {
+			r.artistByName[key] = ar.ID
+		}
+	}
+	if n, err := strconv.Atoi(ar.ID); err == nil && n >= r.nextArtistID {
+		r.nextArtistID = n + 1
+	}
+}
+
+// reset replaces the contents with a copy of c and rebuilds the indexes.
+// If c contains the same artist ID twice, the first one wins. Albums after
+// the first with the same ID, or without one, get the next free numeric
+// ID, so that every album in the list can be found by its ID; reset logs
+// them and returns how many there were.
+//
+// This is also the artist migration: albums stored before artists
+// existed, such as seedAlbums, only have an artist name, and resolving
+// them creates the artist records. Albums whose ArtistID is dangling are
+// resolved by name instead.
+// Caller must hold r.mu or own r exclusively.
+func (r *memoryRepository) reset(c catalog) (renumbered int) {
+	r.artists = make([]artist, 0, len(c.Artists))
+	r.artistIndex = make(map[string]int, len(c.Artists))
+	r.artistByName = make(map[string]string, len(c.Artists))
+	for _, ar := range c.Artists {
+		if _, dup := r.artistIndex[ar.ID]; !dup {
+			r.addArtist(ar)
+		}
+	}
+
+	for _, a := range c.Albums {
+		if n, err := strconv.Atoi(a.ID); err == nil && n >= r.nextID {
+			r.nextID = n + 1
+		}
+	}
+	r.albums = make([]album, len(c.Albums))
+	r.index = make(map[string]int, len(c.Albums))
+	for i, a := range c.Albums {
+		if r.resolveArtist(&a) != nil {
+			a.ArtistID = ""
+			r.resolveArtist(&a)
+		}
+		if _, dup := r.index[a.ID]; dup || a.ID == "" {
+			id := strconv.Itoa(r.nextID)
+			r.nextID++
+			log.Printf("Album %q (%q) has a duplicate or empty ID; renumbered it %s", a.ID, a.Title, id)
+			a.ID = id
+			renumbered++
+		}
+		r.albums[i] = a
+		r.index[a.ID] = i
+	}
+	return renumbered
+}
+
+// contents returns a copy of everything in the repository.
+func (r *memoryRepository) contents() catalog {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return catalog{
+		Artists: append([]artist(nil), r.artists...),
+		Albums:  append([]album(nil), r.albums...),
+	}
+}
+
+// fileRepository is a memoryRepository that persists every change to a
+// JSON file. Writes go to a temporary file first and are renamed into
+// place, so a crash never leaves a half-written file behind.
+type fileRepository struct {
+	mem  *memoryRepository
+	path string
+	// mu serializes writers so the file always matches memory.
+	mu sync.Mutex
+}
+
+// newFileRepository loads albums and artists from path. If the file does
+// not exist it is created with seed. Files written before artists existed
+// hold a plain array of albums; they are migrated and rewritten.
+func newFileRepository(path string, seed catalog) (*fileRepository, error) {
+	r := &fileRepository{path: path}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		r.mem = newMemoryRepository(seed)
+		if err := r.save(r.mem.contents()); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		c, legacy, err := decodeCatalog(data)
+		if err != nil {
+			return nil, err
+		}
+		r.mem = &memoryRepository{nextID: 1, nextArtistID: 1}
+		renumbered := r.mem.reset(c)
+		if legacy || renumbered > 0 {
+			migrated := r.mem.contents()
+			if err := r.save(migrated); err != nil {
+				return nil, err
+			}
+			log.Printf("Migrated %s: %d artist records, %d albums renumbered", path, len(migrated.Artists), renumbered)
+		}
+	}
+	return r, nil
+}
+
+// decodeCatalog parses a repository file. legacy reports that it is a plain
+// array of albums from before artists existed.
+func decodeCatalog(data []byte) (c catalog, legacy bool, err error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return c, true, json.Unmarshal(trimmed, &c.Albums)
+	}
+	return c, false, json.Unmarshal(trimmed, &c)
+}
+
+func (r *fileRepository) List() ([]album, error) {
+	return r.mem.List()
+}
+
+func (r *fileRepository) Get(id string) (album, bool, error) {
+	return r.mem.Get(id)
+}
+
+func (r *fileRepository) ListArtists() ([]artist, error) {
+	return r.mem.ListArtists()
+}
+
+func (r *fileRepository) GetArtist(id string) (artist, bool, error) {
+	return r.mem.GetArtist(id)
+}
+
+func (r *fileRepository) Add(a album) (album, error) {
+	var added album
+	err := r.mutate(func() (err error) {
+		added, err = r.mem.Add(a)
+		return err
+	})
+	return added, err
+}
+
+func (r *fileRepository) Update(a album) (album, error) {
+	var updated album
+	err := r.mutate(func() (err error) {
+		updated, err = r.mem.Update(a)
+		return err
+	})
+	return updated, err
+}
+
+func (r *fileRepository) Patch(id string, fn func(a *album) error) (album, error) {
+	var patched album
+	err := r.mutate(func() (err error) {
+		patched, err = r.mem.Patch(id, fn)
+		return err
+	})
+	return patched, err
+}
+
+func (r *fileRepository) Delete(id string) error {
+	return r.mutate(func() error { return r.mem.Delete(id) })
+}
+
+// mutate applies fn to the in-memory copy and writes the result to disk.
+// If the write fails, memory is rolled back so it keeps matching the file.
+func (r *fileRepository) mutate(fn func() error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := r.mem.contents()
+	r.mem.mu.RLock()
+	nextID, nextArtistID := r.mem.nextID, r.mem.nextArtistID
+	r.mem.mu.RUnlock()
+
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := r.save(r.mem.contents()); err != nil {
+		r.mem.mu.Lock()
+		r.mem.reset(before)
+		r.mem.nextID, r.mem.nextArtistID = nextID, nextArtistID
+		r.mem.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (r *fileRepository) save(c catalog) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// albumFeed wraps a repository and tells subscribers about every album
+// added through it, so gRPC watchers see albums created over REST or
+// GraphQL as well.
+type albumFeed struct {
+	AlbumRepository
+	mu   sync.Mutex
+	subs map[chan album]struct{}
+}
+
+// albumFeedBuffer is how many albums a subscriber may fall behind before
+// it is dropped.
+const albumFeedBuffer = 64
+
+func newAlbumFeed(repo AlbumRepository) *albumFeed {
+	return &albumFeed{AlbumRepository: repo, subs: map[chan album]struct{}{}}
+}
+
+func (f *albumFeed) Add(a album) (album, error) {
+	added, err := f.AlbumRepository.Add(a)
+	if err != nil {
+		return added, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		select {
+		case ch <- added:
+		default:
+			// Never block writers on a slow reader: close its channel so
+			// it knows it missed albums.
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+	return added, nil
+}
+
+// Subscribe returns a channel of albums added from now on. The channel is
+// closed if the subscriber falls too far behind; cancel stops the
+// subscription.
+func (f *albumFeed) Subscribe() (albums <-chan album, cancel func()) {
+	ch := make(chan album, albumFeedBuffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
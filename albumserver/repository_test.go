@@ -0,0 +1,428 @@
+package albumserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Run with go test -race: the tests hammer the repositories from many
+// goroutines, with the 3:1 GET:POST mix of the Locust load test.
+const (
+	testWriters         = 8
+	testAlbumsPerWriter = 50
+	testReadsPerWrite   = 3
+)
+
+// testRepositories makes a repository of each kind holding seedAlbums.
+var testRepositories = map[string]func(t *testing.T) AlbumRepository{
+	"memory": func(t *testing.T) AlbumRepository {
+		return newMemoryRepository(catalog{Albums: seedAlbums})
+	},
+	"file": func(t *testing.T) AlbumRepository {
+		repo, err := newFileRepository(filepath.Join(t.TempDir(), "albums.json"), catalog{Albums: seedAlbums})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	},
+}
+
+func TestRepositoryConcurrentAccess(t *testing.T) {
+	for name, newRepo := range testRepositories {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			hammer(t, repo)
+
+			albums, err := repo.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := len(seedAlbums) + testWriters*testAlbumsPerWriter; len(albums) != want {
+				t.Fatalf("List returned %d albums, want %d", len(albums), want)
+			}
+			seen := make(map[string]bool)
+			for _, a := range albums {
+				if seen[a.ID] {
+					t.Errorf("album ID %q is used twice", a.ID)
+				}
+				seen[a.ID] = true
+			}
+			// Every writer used one of two artist names, spelled
+			// differently, which must have matched one record each.
+			artists, err := repo.ListArtists()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make(map[string]int)
+			for _, ar := range artists {
+				names[artistKey(ar.Name)]++
+			}
+			for _, key := range []string{"test artist a", "test artist b"} {
+				if names[key] != 1 {
+					t.Errorf("%d artist records for %q, want 1", names[key], key)
+				}
+			}
+
+			if fr, ok := repo.(*fileRepository); ok {
+				reopened, err := newFileRepository(fr.path, catalog{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := reopened.List(); len(got) != len(albums) {
+					t.Errorf("file holds %d albums, memory %d", len(got), len(albums))
+				}
+			}
+		})
+	}
+}
+
+func TestRepositoryDuplicateIDs(t *testing.T) {
+	// A file from before artists existed, with album IDs written by hand.
+	path := filepath.Join(t.TempDir(), "albums.json")
+	legacy := `[
+		{"id": "1", "title": "Blue Train", "artist": "John Coltrane", "price": 56.99},
+		{"id": "1", "title": "Giant Steps", "artist": "John Coltrane", "price": 24.99},
+		{"id": "7", "title": "Jeru", "artist": "Gerry Mulligan", "price": 17.99},
+		{"id": "", "title": "Kind of Blue", "artist": "Miles Davis", "price": 29.99},
+		{"id": "7", "title": "Sarah Vaughan", "artist": "Sarah Vaughan", "price": 39.99}
+	]`
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := newFileRepository(path, catalog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	albums, _ := repo.List()
+	var ids []string
+	for _, a := range albums {
+		ids = append(ids, a.ID)
+		if got, ok, _ := repo.Get(a.ID); !ok || got != a {
+			t.Errorf("Get(%q) = %+v, %v; listed as %+v", a.ID, got, ok, a)
+		}
+	}
+	// The first of each ID keeps it; the others are numbered after the
+	// highest ID in the file.
+	if got, want := strings.Join(ids, ","), "1,8,7,9,10"; got != want {
+		t.Errorf("album IDs = %s, want %s", got, want)
+	}
+
+	// The renumbering was saved, so reopening changes nothing.
+	reopened, err := newFileRepository(path, catalog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.List(); fmt.Sprint(got) != fmt.Sprint(albums) {
+		t.Errorf("reopened file holds %v, want %v", got, albums)
+	}
+
+	if err := repo.Delete("7"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.List(); len(got) != len(albums)-1 {
+		t.Errorf("Delete(7) left %d albums, want %d", len(got), len(albums)-1)
+	}
+	if a, ok, _ := repo.Get("10"); !ok || a.Title != "Sarah Vaughan" {
+		t.Errorf("Get(10) = %+v, %v after deleting 7", a, ok)
+	}
+}
+
+// hammer adds albums from testWriters goroutines while readers call List,
+// Get and the artist methods.
+func hammer(t *testing.T, repo AlbumRepository) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for w := range testWriters {
+		wg.Go(func() {
+			for i := range testAlbumsPerWriter {
+				a := album{
+					Title:  fmt.Sprintf("Album %d-%d", w, i),
+					Artist: []string{"Test Artist A", " test  artist b"}[(w+i)%2],
+					Price:  9.99,
+				}
+				// Half the writers pick their own IDs.
+				if w%2 == 0 {
+					a.ID = fmt.Sprintf("w%d-%d", w, i)
+				}
+				added, err := repo.Add(a)
+				if err != nil {
+					t.Errorf("Add: %v", err)
+					return
+				}
+				if got, ok, err := repo.Get(added.ID); err != nil || !ok || got != added {
+					t.Errorf("Get(%q) = %+v, %v, %v; want %+v", added.ID, got, ok, err, added)
+				}
+			}
+		})
+		for range testReadsPerWrite {
+			wg.Go(func() {
+				for i := range testAlbumsPerWriter {
+					albums, err := repo.List()
+					if err != nil {
+						t.Errorf("List: %v", err)
+						return
+					}
+					if len(albums) > 0 {
+						a := albums[i%len(albums)]
+						if _, ok, err := repo.Get(a.ID); err != nil || !ok {
+							t.Errorf("Get(%q) of a listed album = %v, %v", a.ID, ok, err)
+						}
+					}
+					artists, err := repo.ListArtists()
+					if err != nil {
+						t.Errorf("ListArtists: %v", err)
+						return
+					}
+					for _, ar := range artists {
+						if _, ok, err := repo.GetArtist(ar.ID); err != nil || !ok {
+							t.Errorf("GetArtist(%q) = %v, %v", ar.ID, ok, err)
+						}
+					}
+				}
+			})
+		}
+	}
+	wg.Wait()
+}
+
+func TestRepositoryConcurrentPatch(t *testing.T) {
+	for name, newRepo := range testRepositories {
+		t.Run(name, func(t *testing.T) {
+			repo := newRepo(t)
+			start, _, _ := repo.Get("1")
+
+			// Every patch adds one to the price and renames the album, so
+			// a patch applied to a stale copy loses an increment.
+			var wg sync.WaitGroup
+			for w := range testWriters {
+				wg.Go(func() {
+					for i := range testAlbumsPerWriter {
+						_, err := repo.Patch("1", func(a *album) error {
+							a.Price++
+							a.Title = fmt.Sprintf("Album %d-%d", w, i)
+							return nil
+						})
+						if err != nil {
+							t.Errorf("Patch: %v", err)
+							return
+						}
+					}
+				})
+			}
+			wg.Wait()
+
+			got, _, _ := repo.Get("1")
+			if want := start.Price + testWriters*testAlbumsPerWriter; got.Price != want {
+				t.Errorf("price after the patches = %v, want %v", got.Price, want)
+			}
+			if got.Artist != start.Artist || got.ArtistID != start.ArtistID {
+				t.Errorf("patches changed the artist to %q (%s)", got.Artist, got.ArtistID)
+			}
+
+			if _, err := repo.Patch("nope", func(*album) error { return nil }); err != ErrNotFound {
+				t.Errorf("Patch(nope) error = %v, want ErrNotFound", err)
+			}
+			errStop := fmt.Errorf("stop")
+			if _, err := repo.Patch("1", func(a *album) error { a.Price = 0; return errStop }); err != errStop {
+				t.Errorf("Patch error = %v, want fn's error", err)
+			}
+			if after, _, _ := repo.Get("1"); after != got {
+				t.Errorf("failed Patch stored %+v", after)
+			}
+		})
+	}
+}
+
+// slowGetRepository widens the window between reading an album and
+// writing it back, as a handler that merges outside the repository would.
+type slowGetRepository struct {
+	AlbumRepository
+}
+
+func (r slowGetRepository) Get(id string) (album, bool, error) {
+	a, ok, err := r.AlbumRepository.Get(id)
+	time.Sleep(5 * time.Millisecond)
+	return a, ok, err
+}
+
+// TestRouterConcurrentPatch sends pairs of concurrent PATCH requests that
+// each set one field of the same album. Both fields must change, which
+// fails if one PATCH writes back a stale copy of the other field.
+func TestRouterConcurrentPatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	covers, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := slowGetRepository{newMemoryRepository(catalog{Albums: seedAlbums})}
+	router, err := newRouter(repo, covers, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := func(body string) {
+		req := httptest.NewRequest(http.MethodPatch, "/albums/1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("PATCH %s: %d %s", body, rec.Code, rec.Body)
+		}
+	}
+
+	for i := range 10 {
+		var wg sync.WaitGroup
+		wg.Go(func() { patch(fmt.Sprintf(`{"title":"Title %d"}`, i)) })
+		wg.Go(func() { patch(fmt.Sprintf(`{"price":%d}`, i)) })
+		wg.Wait()
+
+		got, _, _ := repo.AlbumRepository.Get("1")
+		if want := fmt.Sprintf("Title %d", i); got.Title != want || got.Price != float64(i) {
+			t.Fatalf("album after round %d = %+v, want title %q and price %d", i, got, want, i)
+		}
+	}
+}
+
+func TestRouterConcurrentRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	covers, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := newRouter(newAlbumFeed(newMemoryRepository(catalog{Albums: seedAlbums})), covers, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for w := range testWriters {
+		wg.Go(func() {
+			for i := range testAlbumsPerWriter {
+				body := fmt.Sprintf(`{"title":"Album %d-%d","artist":"Test Artist","price":9.99}`, w, i)
+				resp, err := http.Post(srv.URL+"/albums", "application/json", strings.NewReader(body))
+				if err != nil {
+					t.Errorf("POST /albums: %v", err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusCreated {
+					t.Errorf("POST /albums: %s", resp.Status)
+				}
+			}
+		})
+		for range testReadsPerWrite {
+			wg.Go(func() {
+				for i := range testAlbumsPerWriter {
+					url := srv.URL + "/albums"
+					if i%2 == 1 {
+						url += "/1"
+					}
+					resp, err := http.Get(url)
+					if err != nil {
+						t.Errorf("GET: %v", err)
+						return
+					}
+					resp.Body.Close()
+					if resp.StatusCode != http.StatusOK {
+						t.Errorf("GET %s: %s", url, resp.Status)
+					}
+				}
+			})
+		}
+	}
+	wg.Wait()
+
+	resp, err := http.Get(srv.URL + "/albums")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var albums []album
+	if err := json.NewDecoder(resp.Body).Decode(&albums); err != nil {
+		t.Fatal(err)
+	}
+	if want := len(seedAlbums) + testWriters*testAlbumsPerWriter; len(albums) != want {
+		t.Errorf("GET /albums returned %d albums, want %d", len(albums), want)
+	}
+}
+
+// benchmarkSizes are the repository sizes the lookup benchmarks compare.
+var benchmarkSizes = []int{1_000, 10_000, 100_000, 1_000_000}
+
+var (
+	benchmarkReposMu sync.Mutex
+	benchmarkRepos   = map[int]*memoryRepository{}
+)
+
+// benchmarkRepo returns a repository of n albums with IDs 1 to n, built
+// once per size and shared by the benchmarks.
+func benchmarkRepo(b *testing.B, n int) *memoryRepository {
+	b.Helper()
+	benchmarkReposMu.Lock()
+	defer benchmarkReposMu.Unlock()
+	if r, ok := benchmarkRepos[n]; ok {
+		return r
+	}
+	r := newMemoryRepository(catalog{})
+	for i := range n {
+		if _, err := r.Add(album{Title: "Album " + strconv.Itoa(i), Artist: "Artist " + strconv.Itoa(i%100), Price: 9.99}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	benchmarkRepos[n] = r
+	return r
+}
+
+// linearGet is Get as it was before the index: a scan of the slice.
+func linearGet(r *memoryRepository, id string) (album, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.albums {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return album{}, false
+}
+
+// benchmarkGet looks up IDs spread over the whole repository.
+func benchmarkGet(b *testing.B, get func(r *memoryRepository, id string) (album, bool)) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("albums=%d", n), func(b *testing.B) {
+			r := benchmarkRepo(b, n)
+			ids := make([]string, 1024)
+			for i := range ids {
+				ids[i] = strconv.Itoa(1 + i*7919%n)
+			}
+			for i := 0; b.Loop(); i++ {
+				if _, ok := get(r, ids[i%len(ids)]); !ok {
+					b.Fatalf("album %s not found", ids[i%len(ids)])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetLinear(b *testing.B) {
+	benchmarkGet(b, linearGet)
+}
+
+func BenchmarkGetIndexed(b *testing.B) {
+	benchmarkGet(b, func(r *memoryRepository, id string) (album, bool) {
+		a, ok, _ := r.Get(id)
+		return a, ok
+	})
+}
@@ -0,0 +1,192 @@
+// Package albumserver is the album service from the homework assignments:
+// a Gin REST API with content negotiation, cover images and artists, a
+// GraphQL endpoint and a gRPC AlbumService, all sharing one repository.
+//
+// Each homework directory has a small main package that calls Main with
+// its own default listen address. See Config for the settings.
+package albumserver
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Main loads the configuration on top of defaults and runs the server
+// until SIGINT or SIGTERM. It exits the process on errors.
+func Main(defaults Config) {
+	cfg, err := LoadConfig(defaults, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := Run(ctx, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Run serves the REST, GraphQL and gRPC APIs until ctx is cancelled or a
+// listener fails, then shuts down gracefully within cfg.ShutdownTimeout.
+func Run(ctx context.Context, cfg Config) error {
+	gin.SetMode(cfg.GinMode)
+
+	store, err := newRepository(cfg)
+	if err != nil {
+		return err
+	}
+	repo := newAlbumFeed(store)
+	covers, err := NewLocalBlobStore(cfg.CoversDir)
+	if err != nil {
+		return err
+	}
+	router, err := newRouter(repo, covers, cfg.CoverMaxBytes)
+	if err != nil {
+		return err
+	}
+
+	tlsEnabled := cfg.TLS.CertFile != ""
+	errc := make(chan error, 2)
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddr != "" {
+		var opts []grpc.ServerOption
+		if tlsEnabled {
+			creds, err := credentials.NewServerTLSFromFile(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, grpc.Creds(creds))
+		}
+		lis, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			return err
+		}
+		grpcServer = newGRPCServer(repo, opts...)
+		log.Printf("Serving gRPC on %s", cfg.GRPCAddr)
+		go func() { errc <- grpcServer.Serve(lis) }()
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           router,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	go func() {
+		var err error
+		if tlsEnabled {
+			log.Printf("Serving HTTPS on %s", cfg.Addr)
+			err = srv.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			log.Printf("Serving HTTP on %s", cfg.Addr)
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			errc <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+		err = nil
+	case err = <-errc:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if grpcServer != nil {
+		// WatchAlbums streams only end when clients go away, so fall
+		// back to a hard stop when the timeout runs out.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		defer func() {
+			select {
+			case <-stopped:
+			case <-shutdownCtx.Done():
+				grpcServer.Stop()
+			}
+		}()
+	}
+	if shutdownErr := srv.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// newRepository opens the repository described by cfg, seeded from
+// cfg.SeedFile or the built-in seedAlbums.
+func newRepository(cfg Config) (AlbumRepository, error) {
+	seed := catalog{Albums: seedAlbums}
+	if cfg.SeedFile != "" {
+		data, err := os.ReadFile(cfg.SeedFile)
+		if err != nil {
+			return nil, err
+		}
+		if seed, _, err = decodeCatalog(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.AlbumsFile == "" {
+		return newMemoryRepository(seed), nil
+	}
+	repo, err := newFileRepository(cfg.AlbumsFile, seed)
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// newRouter registers the album routes backed by repo, with cover images
+// in covers. Cover uploads larger than maxCoverBytes are rejected.
+func newRouter(repo AlbumRepository, covers BlobStore, maxCoverBytes int64) (*gin.Engine, error) {
+	h := &albumHandlers{repo: repo, covers: covers, maxCoverBytes: maxCoverBytes}
+
+	router := gin.Default()
+	// Cover images are served as-is, so only the album documents go
+	// through content negotiation.
+	albums := router.Group("/albums", negotiate)
+	albums.GET("", h.getAlbums)
+	albums.GET("/:id", h.getAlbumByID)
+	albums.POST("", h.postAlbums)
+	albums.PUT("/:id", h.putAlbum)
+	albums.PATCH("/:id", h.patchAlbum)
+	albums.DELETE("/:id", h.deleteAlbum)
+
+	router.PUT("/albums/:id/cover", h.putCover)
+	router.GET("/albums/:id/cover", h.getCover)
+	router.HEAD("/albums/:id/cover", h.getCover)
+
+	artists := router.Group("/artists", negotiate)
+	artists.GET("", h.getArtists)
+	artists.GET("/:id", h.getArtistByID)
+	artists.GET("/:id/albums", h.getArtistAlbums)
+
+	graphQL, err := graphQLHandler(repo)
+	if err != nil {
+		return nil, err
+	}
+	router.GET("/graphql", graphQL)
+	router.POST("/graphql", graphQL)
+	return router, nil
+}